@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetServiceAccounts(c *gin.Context) {
+	db := database.GetDB()
+
+	users := []models.Users{}
+	if err := db.Debug().Where("service_account = ?", true).Order("id").Find(&users).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// CreateServiceAccount creates a user for a machine, it can't sign in and only acts through its API keys
+func CreateServiceAccount(c *gin.Context) {
+	db := database.GetDB()
+
+	ServiceAccountInput := helpers.ServiceAccountInput{}
+
+	if err := c.ShouldBindJSON(&ServiceAccountInput); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if !models.IsUserRole(ServiceAccountInput.Role) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Unknown role " + ServiceAccountInput.Role,
+		})
+
+		return
+	}
+
+	// a leaked key of an admin could hand out roles and keys of its own
+	if ServiceAccountInput.Role == models.RoleAdmin {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Service accounts can't be admins",
+		})
+
+		return
+	}
+
+	// nobody knows the password, the address is reserved and never gets mail
+	User := models.Users{
+		Username:       ServiceAccountInput.Username,
+		Email:          ServiceAccountInput.Username + "@service-accounts.invalid",
+		Password:       helpers.RandomToken(32),
+		Role:           ServiceAccountInput.Role,
+		ServiceAccount: true,
+	}
+
+	tx := db.Begin()
+
+	if err := tx.Debug().Create(&User).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntityUser, User.ID, nil, User.Response()); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, User.Response())
+}
+
+func GetAPIKeys(c *gin.Context) {
+	db := database.GetDB()
+	apiKeys := []models.APIKeys{}
+	apiKeyId := c.Param("apiKeyId")
+
+	if apiKeyId != "" {
+		id, err := strconv.Atoi(apiKeyId)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		result := db.Debug().Where("id = ?", id).Find(&apiKeys)
+		count := result.RowsAffected
+		if result.Error != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		if count < 1 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Data Not Found",
+				"message": "Data Doesn't Exist",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, apiKeys[0])
+		return
+	}
+
+	query := db.Debug().Order("id")
+
+	if userId := c.Query("user_id"); userId != "" {
+		query = query.Where("user_id = ?", userId)
+	}
+
+	if c.Query("active") == "true" {
+		query = query.Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+	}
+
+	if err := query.Find(&apiKeys).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeys)
+}
+
+// CreateAPIKey issues a key for a service account, the key itself is only answered here
+func CreateAPIKey(c *gin.Context) {
+	db := database.GetDB()
+
+	APIKeyInput := helpers.APIKeyInput{}
+
+	if err := c.ShouldBindJSON(&APIKeyInput); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if APIKeyInput.ExpiresAt != nil && APIKeyInput.ExpiresAt.Before(time.Now()) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Expiry has to be in the future",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	User := models.Users{}
+	if err := tx.Debug().Where("id = ? AND service_account = ?", APIKeyInput.UserID, true).First(&User).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Service Account Not Found",
+		})
+
+		return
+	}
+
+	prefix := "ik_" + helpers.RandomToken(4)
+	key := prefix + "_" + helpers.RandomToken(24)
+
+	APIKey := models.APIKeys{
+		UserID:     User.ID,
+		Name:       APIKeyInput.Name,
+		Prefix:     prefix,
+		KeyHash:    helpers.HashToken(key),
+		Scopes:     APIKeyInput.Scopes,
+		AllowedIPs: APIKeyInput.AllowedIPs,
+		ExpiresAt:  APIKeyInput.ExpiresAt,
+	}
+
+	if err := tx.Debug().Create(&APIKey).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntityAPIKey, APIKey.ID, nil, APIKey); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":     key,
+		"api_key": APIKey,
+	})
+}
+
+// RevokeAPIKey stops a key from working right away, the key stays listed for the audit trail
+func RevokeAPIKey(c *gin.Context) {
+	db := database.GetDB()
+
+	apiKeyId, err := strconv.Atoi(c.Param("apiKeyId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	APIKey := models.APIKeys{}
+	if err := tx.Debug().Where("id = ?", apiKeyId).First(&APIKey).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	if APIKey.RevokedAt != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "API Key Already Revoked",
+		})
+
+		return
+	}
+
+	before := APIKey
+
+	if err := tx.Debug().Model(&APIKey).Update("revoked_at", time.Now()).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionRevoke, models.AuditEntityAPIKey, APIKey.ID, before, APIKey); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, APIKey)
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"encoding/json"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// auditSnapshot is the JSON of an entity as the audit log keeps it, nil stays empty
+func auditSnapshot(entity interface{}) (models.RawJSON, error) {
+	if entity == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(entity)
+}
+
+// recordAudit writes who did action to the entity into the audit log, tx is the transaction of the change
+// so the log never shows what was rolled back. before and after are snapshots of the entity, nil when it
+// didn't exist before or doesn't exist anymore
+func recordAudit(c *gin.Context, tx *gorm.DB, action, entityType string, entityID uint, before, after interface{}) error {
+	AuditLog := models.AuditLogs{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		RequestID:  helpers.GetRequestID(c),
+		ClientIP:   c.ClientIP(),
+		OccurredAt: time.Now(),
+	}
+
+	if userID := helpers.GetUserID(c); userID != 0 {
+		AuditLog.UserID = &userID
+	}
+
+	if apiKeyID := helpers.GetAPIKeyID(c); apiKeyID != 0 {
+		AuditLog.APIKeyID = &apiKeyID
+	}
+
+	var err error
+
+	if AuditLog.Before, err = auditSnapshot(before); err != nil {
+		return err
+	}
+
+	if AuditLog.After, err = auditSnapshot(after); err != nil {
+		return err
+	}
+
+	return tx.Debug().Create(&AuditLog).Error
+}
+
+const (
+	auditLogsPageSize    = 100
+	auditLogsMaxPageSize = 500
+)
+
+// GetAuditLogs lists the audit log newest first, filtered by entity, user and date range.
+// from and to are dates and both days are included. It answers a page of limit entries, 100 unless asked
+// for up to 500, skipping the first offset
+func GetAuditLogs(c *gin.Context) {
+	db := database.GetDB()
+
+	query := db.Debug().Order("occurred_at DESC, id DESC")
+
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+
+	if entityId := c.Query("entity_id"); entityId != "" {
+		query = query.Where("entity_id = ?", entityId)
+	}
+
+	if userId := c.Query("user_id"); userId != "" {
+		query = query.Where("user_id = ?", userId)
+	}
+
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	if requestId := c.Query("request_id"); requestId != "" {
+		query = query.Where("request_id = ?", requestId)
+	}
+
+	if from := c.Query("from"); from != "" {
+		date, err := time.ParseInLocation("2006-01-02", from, time.Local)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		query = query.Where("occurred_at >= ?", date)
+	}
+
+	if to := c.Query("to"); to != "" {
+		date, err := time.ParseInLocation("2006-01-02", to, time.Local)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		query = query.Where("occurred_at < ?", date.AddDate(0, 0, 1))
+	}
+
+	limit, offset := auditLogsPageSize, 0
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		var err error
+
+		if limit, err = strconv.Atoi(limitParam); err != nil || limit < 1 || limit > auditLogsMaxPageSize {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+	}
+
+	if offsetParam := c.Query("offset"); offsetParam != "" {
+		var err error
+
+		if offset, err = strconv.Atoi(offsetParam); err != nil || offset < 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+	}
+
+	auditLogs := []models.AuditLogs{}
+	if err := query.Limit(limit).Offset(offset).Find(&auditLogs).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, auditLogs)
+}
+
+// recordDocumentAudit is recordAudit for documents with lines, after is loaded with its lines inside tx
+// so the log shows the document as committed
+func recordDocumentAudit(c *gin.Context, tx *gorm.DB, action, entityType string, entityID uint, before, after interface{}) error {
+	if err := tx.Debug().Preload("Lines").First(after, entityID).Error; err != nil {
+		return err
+	}
+
+	return recordAudit(c, tx, action, entityType, entityID, before, after)
+}
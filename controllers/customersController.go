@@ -0,0 +1,393 @@
+package controllers
+
+import (
+	"errors"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+func GetCustomers(c *gin.Context) {
+	db := database.GetDB()
+	customers := []models.Customers{}
+	customerId := c.Param("customerId")
+
+	if customerId != "" {
+		id, err := strconv.Atoi(customerId)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		result := db.Where("id = ?", id).Find(&customers)
+		count := result.RowsAffected
+		if result.Error != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		if count < 1 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Data Not Found",
+				"message": "Data Doesn't Exist",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, customers[0])
+		return
+	}
+
+	query := db.Debug()
+
+	if name := c.Query("name"); name != "" {
+		query = query.Where("name ILIKE ?", "%"+name+"%")
+	}
+
+	if err := query.Find(&customers).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, customers)
+}
+
+func CreateCustomer(c *gin.Context) {
+	db := database.GetDB()
+	contentType := helpers.GetContentType(c)
+
+	Customer := models.Customers{}
+
+	if contentType == appJSON {
+		c.ShouldBindJSON(&Customer)
+	} else {
+		c.ShouldBind(&Customer)
+	}
+
+	tx := db.Begin()
+
+	if err := tx.Debug().Create(&Customer).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntityCustomer, Customer.ID, nil, Customer); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Customer)
+}
+
+func UpdateCustomer(c *gin.Context) {
+	db := database.GetDB()
+	contentType := helpers.GetContentType(c)
+
+	Customer := models.Customers{}
+
+	customerId, _ := strconv.Atoi(c.Param("customerId"))
+
+	if contentType == appJSON {
+		c.ShouldBindJSON(&Customer)
+	} else {
+		c.ShouldBind(&Customer)
+	}
+
+	Customer.ID = uint(customerId)
+
+	tx := db.Begin()
+
+	previousCustomer := models.Customers{}
+	if err := tx.Debug().Where("id = ?", customerId).First(&previousCustomer).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	err := tx.Model(&Customer).Where("id = ?", customerId).Updates(models.Customers{
+		Code:            Customer.Code,
+		Name:            Customer.Name,
+		ContactName:     Customer.ContactName,
+		Email:           Customer.Email,
+		Phone:           Customer.Phone,
+		ShippingAddress: Customer.ShippingAddress,
+	}).Error
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	UpdatedCustomer := models.Customers{}
+	if err := tx.Debug().First(&UpdatedCustomer, customerId).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionUpdate, models.AuditEntityCustomer, UpdatedCustomer.ID, previousCustomer, UpdatedCustomer); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Customer)
+}
+
+func DeleteCustomer(c *gin.Context) {
+	db := database.GetDB()
+	customerId, err := strconv.Atoi(c.Param("customerId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	Customer := models.Customers{}
+	if err := db.Debug().Where("id = ?", customerId).First(&Customer).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	// outgoing items keep pointing at their customer, so customers are only archived
+	if err := tx.Delete(&Customer).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionArchive, models.AuditEntityCustomer, Customer.ID, Customer, nil); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Successfully archived customer",
+		"customer": Customer,
+	})
+}
+
+// snapshotCustomer checks the customer of an outgoing item and copies the customer's shipping address onto
+// the item when it names none, later changes to the customer leave the item alone
+func snapshotCustomer(tx *gorm.DB, OutgoingItem *models.OutgoingItems) error {
+	if OutgoingItem.CustomerID == nil {
+		return nil
+	}
+
+	Customer := models.Customers{}
+	if err := tx.Debug().Where("id = ?", *OutgoingItem.CustomerID).First(&Customer).Error; err != nil {
+		return errors.New("Customer Not Found")
+	}
+
+	if OutgoingItem.ShippingAddress == "" {
+		OutgoingItem.ShippingAddress = Customer.ShippingAddress
+	}
+
+	return nil
+}
+
+// customerOutgoingItems runs the outgoing items listing for the customer in the path, archived customers included
+func customerOutgoingItems(c *gin.Context, query func(*gorm.DB) *gorm.DB) ([]models.OutgoingItems, bool) {
+	db := database.GetDB()
+
+	customerId, err := strconv.Atoi(c.Param("customerId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return nil, false
+	}
+
+	if err := db.Debug().Unscoped().Where("id = ?", customerId).First(&models.Customers{}).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return nil, false
+	}
+
+	listing, err := outgoingItemsQuery(c, db)
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return nil, false
+	}
+
+	outgoingItems := []models.OutgoingItems{}
+	if err := query(listing.Where("customer_id = ?", customerId)).Find(&outgoingItems).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return nil, false
+	}
+
+	return outgoingItems, true
+}
+
+// GetCustomerOutgoingItems is the history of what went to a customer, it takes the filters of GetOutgoingItems
+func GetCustomerOutgoingItems(c *gin.Context) {
+	outgoingItems, ok := customerOutgoingItems(c, func(db *gorm.DB) *gorm.DB {
+		return db
+	})
+
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, outgoingItems)
+}
+
+// GetCustomerTotals sums per product what went to a customer, cancelled items left out
+func GetCustomerTotals(c *gin.Context) {
+	outgoingItems, ok := customerOutgoingItems(c, func(db *gorm.DB) *gorm.DB {
+		return db.Where("status <> ?", "cancelled")
+	})
+
+	if !ok {
+		return
+	}
+
+	customerId, _ := strconv.Atoi(c.Param("customerId"))
+
+	Totals := helpers.CustomerTotalsResponse{
+		CustomerID:       uint(customerId),
+		From:             c.Query("from"),
+		To:               c.Query("to"),
+		TotalCostOfGoods: decimal.Zero,
+		Products:         []helpers.CustomerProductTotalResponse{},
+	}
+
+	productTotals := map[uint]int{}
+
+	for _, OutgoingItem := range outgoingItems {
+		i, ok := productTotals[OutgoingItem.ProductID]
+
+		if !ok {
+			ProductTotal := helpers.CustomerProductTotalResponse{
+				ProductID:   OutgoingItem.ProductID,
+				Qty:         decimal.Zero,
+				CostOfGoods: decimal.Zero,
+			}
+
+			if OutgoingItem.Products != nil {
+				ProductTotal.Name = OutgoingItem.Products.Name
+				ProductTotal.Unit = OutgoingItem.Products.Unit
+			}
+
+			Totals.Products = append(Totals.Products, ProductTotal)
+			i = len(Totals.Products) - 1
+			productTotals[OutgoingItem.ProductID] = i
+		}
+
+		Totals.Products[i].ItemCount++
+		Totals.Products[i].Qty = Totals.Products[i].Qty.Add(OutgoingItem.BaseQty)
+		Totals.Products[i].CostOfGoods = Totals.Products[i].CostOfGoods.Add(*OutgoingItem.CostOfGoods)
+		Totals.ItemCount++
+		Totals.TotalCostOfGoods = Totals.TotalCostOfGoods.Add(*OutgoingItem.CostOfGoods)
+	}
+
+	c.JSON(http.StatusOK, Totals)
+}
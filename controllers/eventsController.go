@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"inventoryapp/database"
+	"inventoryapp/models"
+	"inventoryapp/outbox"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// GetOutboxEvents lists the domain events in the outbox, pending=true only lists those not published yet
+// and failed=true those given up
+func GetOutboxEvents(c *gin.Context) {
+	db := database.GetDB()
+
+	query := db.Debug().Order("id DESC").Limit(500)
+
+	if productId := c.Query("product_id"); productId != "" {
+		query = query.Where("product_id = ?", productId)
+	}
+
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	if c.Query("pending") == "true" {
+		query = query.Where("published_at IS NULL AND failed_at IS NULL")
+	}
+
+	if c.Query("failed") == "true" {
+		query = query.Where("failed_at IS NOT NULL")
+	}
+
+	events := []models.OutboxEvents{}
+	if err := query.Find(&events).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// StreamEvents streams published events as server-sent events, optionally of one product. A client reconnecting
+// with Last-Event-ID first gets what was published after that event
+func StreamEvents(c *gin.Context) {
+	db := database.GetDB()
+
+	var productID uint64
+
+	if productId := c.Query("product_id"); productId != "" {
+		id, err := strconv.ParseUint(productId, 10, 64)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		productID = id
+	}
+
+	// subscribe before replaying so nothing published in between is missed
+	events, unsubscribe := outbox.Stream.Subscribe()
+	defer unsubscribe()
+
+	missed := []models.OutboxEvents{}
+
+	if lastEventId := c.GetHeader("Last-Event-ID"); lastEventId != "" {
+		query := db.Debug().Where("id > ? AND published_at IS NOT NULL", lastEventId).Order("id").Limit(1000)
+
+		if productID != 0 {
+			query = query.Where("product_id = ?", productID)
+		}
+
+		if err := query.Find(&missed).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	sent := map[uint]bool{}
+
+	c.Stream(func(w io.Writer) bool {
+		if len(missed) > 0 {
+			Event := missed[0]
+			missed = missed[1:]
+			sent[Event.ID] = true
+			c.Render(-1, sse.Event{Id: strconv.FormatUint(uint64(Event.ID), 10), Event: Event.EventType, Data: Event.Payload})
+
+			return true
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case Event := <-events:
+			if (productID == 0 || uint64(Event.ProductID) == productID) && !sent[Event.ID] {
+				c.Render(-1, sse.Event{Id: strconv.FormatUint(uint64(Event.ID), 10), Event: Event.EventType, Data: Event.Payload})
+			}
+
+			return true
+		}
+	})
+}
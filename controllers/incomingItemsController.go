@@ -1,12 +1,17 @@
 package controllers
 
 import (
-	"fmt"
+	"errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"inventoryapp/costing"
 	"inventoryapp/database"
+	"inventoryapp/helpers"
 	"inventoryapp/models"
+	"inventoryapp/outbox"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -31,7 +36,11 @@ func GetIncomingItems(c *gin.Context) {
 
 		result := db.Where("id = ?", id).Preload("Products", func(db *gorm.DB) *gorm.DB {
 			return db.Unscoped()
-		}).Preload("Users").Find(&incomingItems)
+		}).Preload("Users").Preload("Warehouses", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).Preload("Suppliers", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).Preload("Movements.StockLots").Preload("SerialMovements.SerialNumbers").Find(&incomingItems)
 		count := result.RowsAffected
 
 		if result.Error != nil {
@@ -56,9 +65,35 @@ func GetIncomingItems(c *gin.Context) {
 		return
 	}
 
-	if err := db.Debug().Preload("Products", func(db *gorm.DB) *gorm.DB {
+	query := db.Debug().Preload("Products", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Users").Preload("Warehouses", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Suppliers", func(db *gorm.DB) *gorm.DB {
 		return db.Unscoped()
-	}).Preload("Users").Find(&incomingItems).Error; err != nil {
+	})
+
+	if supplierId := c.Query("supplier_id"); supplierId != "" {
+		query = query.Where("supplier_id = ?", supplierId)
+	}
+
+	if supplierReference := c.Query("supplier_reference"); supplierReference != "" {
+		query = query.Where("supplier_reference = ?", supplierReference)
+	}
+
+	if productId := c.Query("product_id"); productId != "" {
+		query = query.Where("product_id = ?", productId)
+	}
+
+	if warehouseId := c.Query("warehouse_id"); warehouseId != "" {
+		query = query.Where("warehouse_id = ?", warehouseId)
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Find(&incomingItems).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -70,12 +105,116 @@ func GetIncomingItems(c *gin.Context) {
 	c.JSON(http.StatusOK, incomingItems)
 }
 
+// bookIncomingItem creates IncomingItem and receives its stock, and its serials for a serialized product.
+// An item against a purchase order line takes product and supplier from the order and counts as received on the line
+func bookIncomingItem(c *gin.Context, tx *gorm.DB, IncomingItem *models.IncomingItems) error {
+	// add status success to incoming item
+	IncomingItem.Status = "succeed"
+
+	// the item is booked by whoever is signed in, never by someone the body names
+	IncomingItem.UserID = helpers.GetUserID(c)
+	IncomingItem.UpdatedByID, IncomingItem.LastUpdatedAt, IncomingItem.CancelledByID, IncomingItem.CancelledAt = nil, nil, nil, nil
+
+	// the order is locked before the product, like every document
+	var PurchaseOrder models.PurchaseOrders
+	var PurchaseOrderLine *models.PurchaseOrderLines
+
+	if IncomingItem.PurchaseOrderLineID != nil {
+		Order, Line, err := lockPurchaseOrderLine(tx, *IncomingItem.PurchaseOrderLineID)
+
+		if err != nil {
+			return err
+		}
+
+		if Order.Status != models.PurchaseOrderStatusOpen && Order.Status != models.PurchaseOrderStatusPartiallyReceived {
+			return errors.New("Purchase order is " + Order.Status)
+		}
+
+		if IncomingItem.ProductID != 0 && IncomingItem.ProductID != Line.ProductID {
+			return errors.New("Product doesn't match the purchase order line")
+		}
+
+		IncomingItem.ProductID = Line.ProductID
+		IncomingItem.SupplierID = &Order.SupplierID
+		PurchaseOrder, PurchaseOrderLine = Order, &Line
+	}
+
+	// lock the product first so the stock read below can't race with another request
+	Product, err := lockProduct(tx, IncomingItem.ProductID)
+
+	if err != nil {
+		return errors.New("Product Not Found")
+	}
+
+	if IncomingItem.SupplierID != nil {
+		if err := tx.Debug().Where("id = ?", *IncomingItem.SupplierID).First(&models.Suppliers{}).Error; err != nil {
+			return errors.New("Supplier Not Found")
+		}
+	}
+
+	// quantity may be given in any unit defined for the product, the ledger always gets the base unit
+	IncomingItem.BaseQty, IncomingItem.Unit, err = toBaseQty(tx, Product, IncomingItem.Qty, IncomingItem.Unit)
+
+	if err != nil {
+		return err
+	}
+
+	if err := checkSerials(Product, IncomingItem.BaseQty, IncomingItem.Serials); err != nil {
+		return err
+	}
+
+	if PurchaseOrderLine != nil {
+		// without a cost of its own the item is priced as ordered
+		if IncomingItem.UnitCost.IsZero() && PurchaseOrderLine.BaseQty.IsPositive() && IncomingItem.Qty.IsPositive() {
+			IncomingItem.UnitCost = PurchaseOrderLine.UnitCost.Mul(PurchaseOrderLine.Qty).Div(PurchaseOrderLine.BaseQty).Mul(IncomingItem.BaseQty).Div(IncomingItem.Qty).Round(6)
+		}
+
+		if err := receivePurchaseOrderLine(tx, PurchaseOrder, *PurchaseOrderLine, IncomingItem.BaseQty); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Debug().Create(IncomingItem).Error; err != nil {
+		return err
+	}
+
+	// above code is adding stock to product from incoming item through the stock ledger, into the lot it names
+	Received, err := receiveStock(c, tx, models.StockMovements{
+		ProductID:   IncomingItem.ProductID,
+		WarehouseID: IncomingItem.WarehouseID,
+		SourceType:  models.MovementSourceIncomingItem,
+		SourceID:    IncomingItem.ID,
+		Action:      models.MovementActionCreated,
+	}, IncomingItem.BaseQty, IncomingItem.LotNumber, IncomingItem.ExpiryDate)
+
+	if err != nil {
+		return err
+	}
+
+	if Product.Serialized {
+		if err := receiveSerials(c, tx, Product.ID, Received.StockLotID, models.SerialMovements{
+			WarehouseID: IncomingItem.WarehouseID,
+			SourceType:  models.MovementSourceIncomingItem,
+			SourceID:    IncomingItem.ID,
+			Action:      models.MovementActionReceived,
+		}, IncomingItem.Serials); err != nil {
+			return err
+		}
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntityIncomingItem, IncomingItem.ID, nil, IncomingItem); err != nil {
+		return err
+	}
+
+	return outbox.Record(tx, models.EventIncomingItemCreated, IncomingItem.ProductID, IncomingItem)
+}
+
 func CreateIncomingItem(c *gin.Context) {
 	db := database.GetDB()
 
 	IncomingItem := models.IncomingItems{}
 
-	if err := c.ShouldBindJSON(&IncomingItem); err != nil {
+	if err := helpers.BindWithoutUserID(c, &IncomingItem); err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -84,10 +223,16 @@ func CreateIncomingItem(c *gin.Context) {
 		return
 	}
 
-	// add status success to incoming item
-	IncomingItem.Status = "succeed"
+	tx := db.Begin()
+
+	if err := bookIncomingItem(c, tx, &IncomingItem); err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
 
-	if err := db.Debug().Create(&IncomingItem).Error; err != nil {
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -96,30 +241,53 @@ func CreateIncomingItem(c *gin.Context) {
 		return
 	}
 
-	// above code is adding stock to product from incoming item
-	Product := models.Products{}
-	if err := db.Debug().Where("id = ?", IncomingItem.ProductID).First(&Product).Error; err != nil {
+	// preload product and user for response
+	if err := db.Debug().Preload("Products").Preload("Users").Preload("Warehouses").Preload("Suppliers").Preload("Movements.StockLots").Preload("SerialMovements.SerialNumbers").First(&IncomingItem, IncomingItem.ID).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Product Not Found",
+			"message": err.Error(),
 		})
 
 		return
 	}
 
-	// and then update stock
-	Product.Stock += IncomingItem.Qty
-	if err := db.Debug().Save(&Product).Error; err != nil {
+	c.JSON(http.StatusOK, IncomingItem)
+}
+
+func UpdateIncomingItem(c *gin.Context) {
+	db := database.GetDB()
+
+	incomingItemId, _ := strconv.Atoi(c.Param("incomingItemId"))
+
+	// start transaction
+	tx := db.Begin()
+
+	previousIncomingItem := models.IncomingItems{}
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", incomingItemId).First(&previousIncomingItem).Error; err != nil {
+		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Failed to update stock",
+			"message": "Incoming Item Not Found",
 		})
 
 		return
 	}
 
-	// preload product and user for response
-	if err := db.Debug().Preload("Products").Preload("Users").First(&IncomingItem, IncomingItem.ID).Error; err != nil {
+	if previousIncomingItem.Status == "cancelled" {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Incoming Item Already Cancelled",
+		})
+
+		return
+	}
+
+	// the body is bound over the item, what it leaves out stays as it was and what it sets may be zero
+	IncomingItem := previousIncomingItem
+
+	if err := helpers.BindWithoutUserID(c, &IncomingItem); err != nil {
+		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -128,16 +296,44 @@ func CreateIncomingItem(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, IncomingItem)
-}
+	// the purchase order is locked before the product, like every document
+	var PurchaseOrder *models.PurchaseOrders
+	var PurchaseOrderLine models.PurchaseOrderLines
 
-func UpdateIncomingItem(c *gin.Context) {
-	db := database.GetDB()
+	if previousIncomingItem.PurchaseOrderLineID != nil {
+		Order, Line, err := lockPurchaseOrderLine(tx, *previousIncomingItem.PurchaseOrderLineID)
 
-	IncomingItem := models.IncomingItems{}
-	incomingItemId, _ := strconv.Atoi(c.Param("incomingItemId"))
+		if err != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+
+		PurchaseOrder, PurchaseOrderLine = &Order, Line
+	}
+
+	previousQty := previousIncomingItem.BaseQty
+
+	Product, err := lockProduct(tx, previousIncomingItem.ProductID)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Product Not Found",
+		})
+
+		return
+	}
 
-	if err := c.ShouldBindJSON(&IncomingItem); err != nil {
+	IncomingItem.BaseQty, IncomingItem.Unit, err = toBaseQty(tx, Product, IncomingItem.Qty, IncomingItem.Unit)
+
+	if err != nil {
+		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -146,29 +342,60 @@ func UpdateIncomingItem(c *gin.Context) {
 		return
 	}
 
-	IncomingItem.ID = uint(incomingItemId)
+	if IncomingItem.UnitCost.IsNegative() {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Your unit cost can't be negative",
+		})
 
-	// start transaction
-	tx := db.Begin()
+		return
+	}
 
-	previousIncomingItem := models.IncomingItems{}
-	if err := tx.Debug().Where("id = ?", incomingItemId).First(&previousIncomingItem).Error; err != nil {
+	// the serials of a serialized item are fixed, a different quantity needs a new item
+	if Product.Serialized && !IncomingItem.BaseQty.Equal(previousQty) {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Incoming Item Not Found",
+			"message": "Quantity of a serialized item can't change, cancel the item instead",
 		})
 
 		return
 	}
 
-	previousQty := previousIncomingItem.Qty
+	// an item received against a purchase order keeps the supplier of the order
+	if PurchaseOrder != nil {
+		IncomingItem.SupplierID = previousIncomingItem.SupplierID
+	}
 
-	if err := tx.Debug().Model(&previousIncomingItem).Updates(models.IncomingItems{
-		Qty:        IncomingItem.Qty,
-		IncomingAt: IncomingItem.IncomingAt,
-		UserID:     IncomingItem.UserID,
-		// ProductID:  IncomingItem.ProductID,
+	if IncomingItem.SupplierID != nil && (previousIncomingItem.SupplierID == nil || *IncomingItem.SupplierID != *previousIncomingItem.SupplierID) {
+		if err := tx.Debug().Where("id = ?", *IncomingItem.SupplierID).First(&models.Suppliers{}).Error; err != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Supplier Not Found",
+			})
+
+			return
+		}
+	}
+
+	userID := helpers.GetUserID(c)
+	now := time.Now()
+
+	before := previousIncomingItem
+
+	// Select writes zero values too, a unit cost of 0 or a cleared supplier is stored as sent
+	if err := tx.Debug().Model(&previousIncomingItem).Select("qty", "unit", "base_qty", "unit_cost", "supplier_id", "supplier_reference", "incoming_at", "updated_by_id", "last_updated_at").Updates(models.IncomingItems{
+		Qty:               IncomingItem.Qty,
+		Unit:              IncomingItem.Unit,
+		BaseQty:           IncomingItem.BaseQty,
+		UnitCost:          IncomingItem.UnitCost,
+		SupplierID:        IncomingItem.SupplierID,
+		SupplierReference: IncomingItem.SupplierReference,
+		IncomingAt:        IncomingItem.IncomingAt,
+		UpdatedByID:       &userID,
+		LastUpdatedAt:     &now,
 	}).Error; err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
@@ -179,51 +406,89 @@ func UpdateIncomingItem(c *gin.Context) {
 		return
 	}
 
-	diff := IncomingItem.Qty - previousQty
+	diff := IncomingItem.BaseQty.Sub(previousQty)
 
-	// get the associated product
-	Product := models.Products{}
-	if err := tx.Debug().Where("id = ?", previousIncomingItem.ProductID).First(&Product).Error; err != nil {
+	if PurchaseOrder != nil && !diff.IsZero() {
+		if err := receivePurchaseOrderLine(tx, *PurchaseOrder, PurchaseOrderLine, diff); err != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	Movement := models.StockMovements{
+		ProductID:   previousIncomingItem.ProductID,
+		WarehouseID: previousIncomingItem.WarehouseID,
+		SourceType:  models.MovementSourceIncomingItem,
+		SourceID:    previousIncomingItem.ID,
+		Action:      models.MovementActionUpdated,
+	}
+
+	// adjust the lot of the item with the difference, unchanged quantity leaves the ledger untouched.
+	// Less received can't take away what sales orders reserved
+	if diff.IsPositive() {
+		_, err = receiveStock(c, tx, Movement, diff, previousIncomingItem.LotNumber, previousIncomingItem.ExpiryDate)
+	} else if diff.IsNegative() {
+		reduction := diff.Neg()
+
+		if err = checkAvailable(tx, Product, previousIncomingItem.WarehouseID, reduction); err == nil {
+			_, err = returnStock(c, tx, Movement, &reduction)
+		}
+	}
+
+	if err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
+
+		return
+	}
+
+	// the outgoing items issued after the receipt are costed from it
+	if _, err := costing.Recost(tx, previousIncomingItem.ProductID, models.MovementSourceIncomingItem, previousIncomingItem.ID); err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Product Not Found",
+			"message": err.Error(),
 		})
 
 		return
 	}
 
-	// adjust the product stock
-	newStock := Product.Stock + diff
-
-	fmt.Printf("IncomingItem qty: %d, Previous stock: %d, Diff: %d, New stock: %d, Product Stock: %d\n", IncomingItem.Qty, previousIncomingItem.Qty, diff, newStock, Product.Stock)
-
-	if newStock < 0 {
+	if err := outbox.Record(tx, models.EventIncomingItemUpdated, previousIncomingItem.ProductID, previousIncomingItem); err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Stock cannot be negative",
+			"message": err.Error(),
 		})
 
 		return
 	}
-	Product.Stock = newStock
 
-	// update stock
-	if err := tx.Debug().Save(&Product).Error; err != nil {
+	if err := recordAudit(c, tx, models.AuditActionUpdate, models.AuditEntityIncomingItem, previousIncomingItem.ID, before, previousIncomingItem); err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Failed to update stock",
+			"message": err.Error(),
 		})
 
 		return
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
 
 	// preload product and user for response
-	if err := db.Debug().Preload("Products").Preload("Users").First(&IncomingItem, IncomingItem.ID).Error; err != nil {
+	if err := db.Debug().Preload("Products").Preload("Users").Preload("Warehouses").First(&IncomingItem, IncomingItem.ID).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -251,7 +516,7 @@ func CancelIncomingItem(c *gin.Context) {
 	tx := db.Begin()
 
 	previousIncomingItem := models.IncomingItems{}
-	if err := tx.Debug().Where("id = ?", incomingItemId).First(&previousIncomingItem).Error; err != nil {
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", incomingItemId).First(&previousIncomingItem).Error; err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
@@ -261,22 +526,39 @@ func CancelIncomingItem(c *gin.Context) {
 		return
 	}
 
-	previousQty := previousIncomingItem.Qty
-
-	if err := tx.Debug().Model(&previousIncomingItem).Update("status", "cancelled").Error; err != nil {
+	if previousIncomingItem.Status == "cancelled" {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": err.Error(),
+			"message": "Incoming Item Already Cancelled",
 		})
 
 		return
 	}
 
-	diff := previousQty
+	// the purchase order is locked before the product, like every document, and no longer counts the item as received
+	if previousIncomingItem.PurchaseOrderLineID != nil {
+		PurchaseOrder, PurchaseOrderLine, err := lockPurchaseOrderLine(tx, *previousIncomingItem.PurchaseOrderLineID)
+
+		if err == nil {
+			err = receivePurchaseOrderLine(tx, PurchaseOrder, PurchaseOrderLine, previousIncomingItem.BaseQty.Neg())
+		}
+
+		if err != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	// what the item received can't go back while sales orders reserved it
+	Product, err := lockProduct(tx, previousIncomingItem.ProductID)
 
-	Product := models.Products{}
-	if err := tx.Debug().Where("id = ?", previousIncomingItem.ProductID).First(&Product).Error; err != nil {
+	if err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
@@ -286,21 +568,58 @@ func CancelIncomingItem(c *gin.Context) {
 		return
 	}
 
-	newStock := Product.Stock - diff
+	if err := checkAvailable(tx, Product, previousIncomingItem.WarehouseID, previousIncomingItem.BaseQty); err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
+
+		return
+	}
+
+	before := previousIncomingItem
+
+	userID := helpers.GetUserID(c)
 
-	if newStock < 0 {
+	if err := tx.Debug().Model(&previousIncomingItem).Updates(map[string]interface{}{
+		"status":          "cancelled",
+		"cancelled_by_id": userID,
+		"cancelled_at":    time.Now(),
+	}).Error; err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Stock of Product Can't be negative",
+			"message": err.Error(),
 		})
 
 		return
 	}
 
-	Product.Stock = newStock
+	// take back out of the lot whatever the item put into it
+	if _, err := returnStock(c, tx, models.StockMovements{
+		ProductID:   previousIncomingItem.ProductID,
+		WarehouseID: previousIncomingItem.WarehouseID,
+		SourceType:  models.MovementSourceIncomingItem,
+		SourceID:    previousIncomingItem.ID,
+		Action:      models.MovementActionCancelled,
+	}, nil); err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
 
-	if err := tx.Debug().Save(&Product).Error; err != nil {
+		return
+	}
+
+	if err := returnSerials(c, tx, models.SerialMovements{
+		SourceType: models.MovementSourceIncomingItem,
+		SourceID:   previousIncomingItem.ID,
+		Action:     models.MovementActionCancelled,
+	}); err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
+
+		return
+	}
+
+	// the outgoing items issued after the receipt are costed from it
+	if _, err := costing.Recost(tx, previousIncomingItem.ProductID, models.MovementSourceIncomingItem, previousIncomingItem.ID); err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
@@ -310,7 +629,34 @@ func CancelIncomingItem(c *gin.Context) {
 		return
 	}
 
-	tx.Commit()
+	if err := outbox.Record(tx, models.EventIncomingItemCancelled, previousIncomingItem.ProductID, previousIncomingItem); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCancel, models.AuditEntityIncomingItem, previousIncomingItem.ID, before, previousIncomingItem); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
 
 	IncomingItem := models.IncomingItems{}
 	if err := db.Debug().First(&IncomingItem, incomingItemId).Error; err != nil {
@@ -322,7 +668,7 @@ func CancelIncomingItem(c *gin.Context) {
 		return
 	}
 
-	if err := db.Debug().Preload("Products").Preload("Users").First(&IncomingItem, incomingItemId).Error; err != nil {
+	if err := db.Debug().Preload("Products").Preload("Users").Preload("Warehouses").First(&IncomingItem, incomingItemId).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -0,0 +1,13 @@
+package controllers
+
+import (
+	"inventoryapp/helpers"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publishes the public keys tokens are signed with, so other services can verify them
+func GetJWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, helpers.JWKS())
+}
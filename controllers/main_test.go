@@ -0,0 +1,102 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"inventoryapp/router"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the tests in here run the whole API against a Postgres database, they are skipped unless TEST_DATABASE_URL
+// names one they may write to
+var server *gin.Engine
+
+func TestMain(m *testing.M) {
+	if dsn := os.Getenv("TEST_DATABASE_URL"); dsn != "" {
+		if os.Getenv("JWT_KEYS") == "" && os.Getenv("JWT_SECRET") == "" {
+			os.Setenv("JWT_SECRET", "a secret only the tests sign with, long enough")
+		}
+
+		if err := helpers.LoadSigningKeys(); err != nil {
+			log.Fatal(err)
+		}
+
+		gin.SetMode(gin.TestMode)
+		database.Connect(dsn)
+		server = router.StartServer()
+	}
+
+	os.Exit(m.Run())
+}
+
+func requireDB(t *testing.T) {
+	t.Helper()
+
+	if server == nil {
+		t.Skip("TEST_DATABASE_URL isn't set")
+	}
+}
+
+// signIn creates a user with role and answers a token of it
+func signIn(t *testing.T, role string) string {
+	t.Helper()
+
+	name := "test_" + helpers.RandomToken(4)
+	User := models.Users{Username: name, Email: name + "@example.com", Password: helpers.RandomToken(8), Role: role}
+
+	if err := database.GetDB().Create(&User).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	token, _ := helpers.GenerateToken(User.ID, User.Email, User.Role)
+
+	return token
+}
+
+// createWarehouse creates a warehouse with a code of its own
+func createWarehouse(t *testing.T) models.Warehouses {
+	t.Helper()
+
+	Warehouse := models.Warehouses{Code: "T" + helpers.RandomToken(4), Name: "Test Warehouse"}
+
+	if err := database.GetDB().Create(&Warehouse).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return Warehouse
+}
+
+// call sends body as JSON to the API and answers the recorded response
+func call(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload []byte
+
+	if body != nil {
+		var err error
+
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+
+	return recorder
+}
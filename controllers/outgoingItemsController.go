@@ -1,15 +1,71 @@
 package controllers
 
 import (
+	"errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"inventoryapp/costing"
 	"inventoryapp/database"
+	"inventoryapp/helpers"
 	"inventoryapp/models"
+	"inventoryapp/outbox"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// outgoingItemsQuery is the listing behind GetOutgoingItems filtered by the query string,
+// from and to are dates and both days are included
+func outgoingItemsQuery(c *gin.Context, db *gorm.DB) (*gorm.DB, error) {
+	query := db.Debug().Preload("Products", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Users").Preload("Warehouses", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Customers", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Order("outgoing_at, id")
+
+	if customerId := c.Query("customer_id"); customerId != "" {
+		query = query.Where("customer_id = ?", customerId)
+	}
+
+	if productId := c.Query("product_id"); productId != "" {
+		query = query.Where("product_id = ?", productId)
+	}
+
+	if warehouseId := c.Query("warehouse_id"); warehouseId != "" {
+		query = query.Where("warehouse_id = ?", warehouseId)
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if from := c.Query("from"); from != "" {
+		date, err := time.Parse("2006-01-02", from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		query = query.Where("outgoing_at >= ?", date)
+	}
+
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse("2006-01-02", to)
+
+		if err != nil {
+			return nil, err
+		}
+
+		query = query.Where("outgoing_at < ?", date.AddDate(0, 0, 1))
+	}
+
+	return query, nil
+}
+
 func GetOutgoingItems(c *gin.Context) {
 	db := database.GetDB()
 
@@ -30,7 +86,11 @@ func GetOutgoingItems(c *gin.Context) {
 
 		result := db.Debug().Where("id = ?", id).Preload("Products", func(db *gorm.DB) *gorm.DB {
 			return db.Unscoped()
-		}).Preload("Users").Find(&outgoingItems)
+		}).Preload("Users").Preload("Warehouses", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).Preload("Customers", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).Preload("Movements.StockLots").Preload("SerialMovements.SerialNumbers").Find(&outgoingItems)
 		count := result.RowsAffected
 
 		if result.Error != nil {
@@ -56,9 +116,18 @@ func GetOutgoingItems(c *gin.Context) {
 		return
 	}
 
-	if err := db.Debug().Preload("Products", func(db *gorm.DB) *gorm.DB {
-		return db.Unscoped()
-	}).Preload("Users").Find(&outgoingItems).Error; err != nil {
+	query, err := outgoingItemsQuery(c, db)
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	if err := query.Find(&outgoingItems).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -70,11 +139,125 @@ func GetOutgoingItems(c *gin.Context) {
 	c.JSON(http.StatusOK, outgoingItems)
 }
 
+// bookOutgoingItem creates OutgoingItem inside tx and takes its stock out of the ledger, with its serials
+// for a serialized product. An item of a sales order line ships the line and consumes its reservation,
+// any other item may only take what no sales order reserved
+func bookOutgoingItem(c *gin.Context, tx *gorm.DB, OutgoingItem *models.OutgoingItems) error {
+	// add status success to outgoing item
+	OutgoingItem.Status = "succeed"
+
+	// the item is booked by whoever is signed in, never by someone the body names
+	OutgoingItem.UserID = helpers.GetUserID(c)
+	OutgoingItem.UpdatedByID, OutgoingItem.LastUpdatedAt, OutgoingItem.CancelledByID, OutgoingItem.CancelledAt = nil, nil, nil, nil
+	OutgoingItem.CostOfGoods = nil
+
+	// the order is locked before the product, like every document
+	var SalesOrder models.SalesOrders
+	var SalesOrderLine *models.SalesOrderLines
+
+	if OutgoingItem.SalesOrderLineID != nil {
+		Order, Line, err := lockSalesOrderLine(tx, *OutgoingItem.SalesOrderLineID)
+
+		if err != nil {
+			return err
+		}
+
+		if !isReserving(Order) {
+			return errors.New("Sales order is " + Order.Status)
+		}
+
+		if OutgoingItem.ProductID != 0 && OutgoingItem.ProductID != Line.ProductID {
+			return errors.New("Product doesn't match the sales order line")
+		}
+
+		if OutgoingItem.WarehouseID != 0 && OutgoingItem.WarehouseID != Order.WarehouseID {
+			return errors.New("Warehouse doesn't match the sales order")
+		}
+
+		OutgoingItem.ProductID = Line.ProductID
+		OutgoingItem.WarehouseID = Order.WarehouseID
+		OutgoingItem.CustomerID = &Order.CustomerID
+		SalesOrder, SalesOrderLine = Order, &Line
+	}
+
+	// lock the product first so the stock read below can't race with another request
+	Product, err := lockProduct(tx, OutgoingItem.ProductID)
+
+	if err != nil {
+		return errors.New("Product Not Found")
+	}
+
+	if err := snapshotCustomer(tx, OutgoingItem); err != nil {
+		return err
+	}
+
+	// quantity may be given in any unit defined for the product, the ledger always gets the base unit
+	OutgoingItem.BaseQty, OutgoingItem.Unit, err = toBaseQty(tx, Product, OutgoingItem.Qty, OutgoingItem.Unit)
+
+	if err != nil {
+		return err
+	}
+
+	if err := checkSerials(Product, OutgoingItem.BaseQty, OutgoingItem.Serials); err != nil {
+		return err
+	}
+
+	if SalesOrderLine != nil {
+		err = shipSalesOrderLine(tx, SalesOrder, *SalesOrderLine, OutgoingItem.BaseQty)
+	} else {
+		err = checkAvailable(tx, Product, OutgoingItem.WarehouseID, OutgoingItem.BaseQty)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Debug().Create(OutgoingItem).Error; err != nil {
+		return err
+	}
+
+	Movement := models.StockMovements{
+		ProductID:   OutgoingItem.ProductID,
+		WarehouseID: OutgoingItem.WarehouseID,
+		SourceType:  models.MovementSourceOutgoingItem,
+		SourceID:    OutgoingItem.ID,
+		Action:      models.MovementActionCreated,
+	}
+
+	// above code is for reducing stock of product from outgoing item through the stock ledger,
+	// from the lots of the serials issued, the lots the item names or first-expiry-first-out
+	if Product.Serialized {
+		_, err = issueSerializedStock(c, tx, Movement, OutgoingItem.Serials)
+	} else {
+		_, err = issueStock(c, tx, Movement, OutgoingItem.BaseQty, OutgoingItem.LotNumbers, true)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// the cost of goods is stored with the item, so listing items doesn't replay the ledger
+	costs, err := costing.Recost(tx, OutgoingItem.ProductID, models.MovementSourceOutgoingItem, OutgoingItem.ID)
+
+	if err != nil {
+		return err
+	}
+
+	costOfGoods := costs[OutgoingItem.ID]
+	OutgoingItem.CostOfGoods = &costOfGoods
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntityOutgoingItem, OutgoingItem.ID, nil, OutgoingItem); err != nil {
+		return err
+	}
+
+	return outbox.Record(tx, models.EventOutgoingItemCreated, OutgoingItem.ProductID, OutgoingItem)
+}
+
 func CreateOutgoingItem(c *gin.Context) {
 	db := database.GetDB()
 	OutgoingItem := models.OutgoingItems{}
 
-	if err := c.ShouldBindBodyWithJSON(&OutgoingItem); err != nil {
+	if err := helpers.BindWithoutUserID(c, &OutgoingItem); err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -83,10 +266,16 @@ func CreateOutgoingItem(c *gin.Context) {
 		return
 	}
 
-	// add status success to outgoing item
-	OutgoingItem.Status = "succeed"
+	tx := db.Begin()
+
+	if err := bookOutgoingItem(c, tx, &OutgoingItem); err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
 
-	if err := db.Debug().Create(&OutgoingItem).Error; err != nil {
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -95,31 +284,52 @@ func CreateOutgoingItem(c *gin.Context) {
 		return
 	}
 
-	// above code is for reducing stock of product from outgoing item
-	Product := models.Products{}
-	if err := db.Debug().Where("id = ?", OutgoingItem.ProductID).First(&Product).Error; err != nil {
+	// preload product and user for response
+	if err := db.Debug().Preload("Products").Preload("Users").Preload("Warehouses").Preload("Customers").Preload("Movements.StockLots").Preload("SerialMovements.SerialNumbers").Find(&OutgoingItem, OutgoingItem.ID).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Product Not Found",
+			"message": err.Error(),
 		})
 
 		return
 	}
 
-	// and then update the stock of product
-	Product.Stock -= OutgoingItem.Qty
+	c.JSON(http.StatusOK, OutgoingItem)
+}
+
+func UpdateOutgoingItem(c *gin.Context) {
+	db := database.GetDB()
+
+	outgoingItemId, _ := strconv.Atoi(c.Param("outgoingItemId"))
+
+	tx := db.Begin()
 
-	if err := db.Debug().Save(&Product).Error; err != nil {
+	previousOutgoingItem := models.OutgoingItems{}
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", outgoingItemId).First(&previousOutgoingItem).Error; err != nil {
+		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": err.Error(),
+			"message": "Outgoing Item Not Found",
 		})
 
 		return
 	}
 
-	// preload product and user for response
-	if err := db.Debug().Preload("Products").Preload("Users").Find(&OutgoingItem, OutgoingItem.ID).Error; err != nil {
+	if previousOutgoingItem.Status == "cancelled" {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Outgoing Item Already Cancelled",
+		})
+
+		return
+	}
+
+	// the body is bound over the item, what it leaves out stays as it was and a null customer_id clears it
+	OutgoingItem := previousOutgoingItem
+
+	if err := helpers.BindWithoutUserID(c, &OutgoingItem); err != nil {
+		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -128,16 +338,44 @@ func CreateOutgoingItem(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, OutgoingItem)
-}
+	// the sales order is locked before the product, like every document
+	var SalesOrder *models.SalesOrders
+	var SalesOrderLine models.SalesOrderLines
 
-func UpdateOutgoingItem(c *gin.Context) {
-	db := database.GetDB()
+	if previousOutgoingItem.SalesOrderLineID != nil {
+		Order, Line, err := lockSalesOrderLine(tx, *previousOutgoingItem.SalesOrderLineID)
 
-	OutgoingItem := models.OutgoingItems{}
-	outgoingItemId, _ := strconv.Atoi(c.Param("outgoingItemId"))
+		if err != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
 
-	if err := c.ShouldBindJSON(&OutgoingItem); err != nil {
+			return
+		}
+
+		SalesOrder, SalesOrderLine = &Order, Line
+	}
+
+	previousQty := previousOutgoingItem.BaseQty
+
+	Product, err := lockProduct(tx, previousOutgoingItem.ProductID)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Product Not Found",
+		})
+
+		return
+	}
+
+	OutgoingItem.BaseQty, OutgoingItem.Unit, err = toBaseQty(tx, Product, OutgoingItem.Qty, OutgoingItem.Unit)
+
+	if err != nil {
+		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -146,27 +384,71 @@ func UpdateOutgoingItem(c *gin.Context) {
 		return
 	}
 
-	OutgoingItem.ID = uint(outgoingItemId)
+	// the serials of a serialized item are fixed, a different quantity needs a new item
+	if Product.Serialized && !OutgoingItem.BaseQty.Equal(previousQty) {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Quantity of a serialized item can't change, cancel the item instead",
+		})
 
-	tx := db.Begin()
+		return
+	}
 
-	previousOutgoingItem := models.OutgoingItems{}
-	if err := tx.Debug().Where("id = ?", outgoingItemId).First(&previousOutgoingItem).Error; err != nil {
+	// an item shipped against a sales order keeps the customer of the order
+	if SalesOrder != nil {
+		OutgoingItem.CustomerID = &SalesOrder.CustomerID
+	}
+
+	// the address of the previous customer doesn't follow the item to another one
+	customerChanged := (OutgoingItem.CustomerID == nil) != (previousOutgoingItem.CustomerID == nil) ||
+		(OutgoingItem.CustomerID != nil && previousOutgoingItem.CustomerID != nil && *OutgoingItem.CustomerID != *previousOutgoingItem.CustomerID)
+
+	if customerChanged && OutgoingItem.ShippingAddress == previousOutgoingItem.ShippingAddress {
+		OutgoingItem.ShippingAddress = ""
+	}
+
+	if err := snapshotCustomer(tx, &OutgoingItem); err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Outgoing Item Not Found",
+			"message": err.Error(),
 		})
 
 		return
 	}
 
-	previousQty := previousOutgoingItem.Qty
+	diff := previousQty.Sub(OutgoingItem.BaseQty)
+
+	// shipping more of a sales order line must stay within the order, any other item must stay within what is available
+	if SalesOrder != nil && !diff.IsZero() {
+		err = shipSalesOrderLine(tx, *SalesOrder, SalesOrderLine, diff.Neg())
+	} else if SalesOrder == nil && diff.IsNegative() {
+		err = checkAvailable(tx, Product, previousOutgoingItem.WarehouseID, diff.Neg())
+	}
+
+	if err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
 
-	if err := tx.Debug().Model(&previousOutgoingItem).Updates(models.OutgoingItems{
-		Qty:        OutgoingItem.Qty,
-		OutgoingAt: OutgoingItem.OutgoingAt,
-		UserID:     OutgoingItem.UserID,
+		return
+	}
+
+	userID := helpers.GetUserID(c)
+	now := time.Now()
+
+	before := previousOutgoingItem
+
+	// Select writes zero values too, so the customer and the shipping address can be cleared
+	if err := tx.Debug().Model(&previousOutgoingItem).Select("qty", "unit", "base_qty", "outgoing_at", "customer_id", "shipping_address", "updated_by_id", "last_updated_at").Updates(models.OutgoingItems{
+		Qty:             OutgoingItem.Qty,
+		Unit:            OutgoingItem.Unit,
+		BaseQty:         OutgoingItem.BaseQty,
+		OutgoingAt:      OutgoingItem.OutgoingAt,
+		CustomerID:      OutgoingItem.CustomerID,
+		ShippingAddress: OutgoingItem.ShippingAddress,
+		UpdatedByID:     &userID,
+		LastUpdatedAt:   &now,
 	}).Error; err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
@@ -177,36 +459,56 @@ func UpdateOutgoingItem(c *gin.Context) {
 		return
 	}
 
-	diff := previousQty - OutgoingItem.Qty
+	Movement := models.StockMovements{
+		ProductID:   previousOutgoingItem.ProductID,
+		WarehouseID: previousOutgoingItem.WarehouseID,
+		SourceType:  models.MovementSourceOutgoingItem,
+		SourceID:    previousOutgoingItem.ID,
+		Action:      models.MovementActionUpdated,
+	}
+
+	// issuing less returns stock to the lots it came from, issuing more draws from the lots again,
+	// unchanged quantity leaves the ledger untouched
+	if diff.IsPositive() {
+		_, err = returnStock(c, tx, Movement, &diff)
+	} else if diff.IsNegative() {
+		_, err = issueStock(c, tx, Movement, diff.Neg(), OutgoingItem.LotNumbers, true)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
+
+		return
+	}
+
+	// items issued after this one may have drawn other layers now
+	costs, err := costing.Recost(tx, previousOutgoingItem.ProductID, models.MovementSourceOutgoingItem, previousOutgoingItem.ID)
 
-	// get the associated product
-	Product := models.Products{}
-	if err := tx.Debug().Where("id = ?", previousOutgoingItem.ProductID).First(&Product).Error; err != nil {
+	if err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Product Not Found",
+			"message": err.Error(),
 		})
 
 		return
 	}
 
-	// adjust the product stock
-	newStock := Product.Stock + diff
+	costOfGoods := costs[previousOutgoingItem.ID]
+	previousOutgoingItem.CostOfGoods = &costOfGoods
 
-	if newStock < 0 {
+	if err := outbox.Record(tx, models.EventOutgoingItemUpdated, previousOutgoingItem.ProductID, previousOutgoingItem); err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Stock of Product Can't be Negative",
+			"message": err.Error(),
 		})
 
 		return
 	}
-	Product.Stock = newStock
 
-	// update stock
-	if err := tx.Debug().Save(&Product).Error; err != nil {
+	if err := recordAudit(c, tx, models.AuditActionUpdate, models.AuditEntityOutgoingItem, previousOutgoingItem.ID, before, previousOutgoingItem); err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
@@ -216,10 +518,17 @@ func UpdateOutgoingItem(c *gin.Context) {
 		return
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
 
 	// preload product and user for response
-	if err := db.Debug().Preload("Products").Preload("Users").Find(&OutgoingItem, OutgoingItem.ID).Error; err != nil {
+	if err := db.Debug().Preload("Products").Preload("Users").Preload("Warehouses").Find(&OutgoingItem, OutgoingItem.ID).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -248,7 +557,7 @@ func CancelOutgoingItem(c *gin.Context) {
 	tx := db.Begin()
 
 	previousOutgoingItem := models.OutgoingItems{}
-	if err := tx.Debug().Where("id = ?", outgoingItemId).First(&previousOutgoingItem).Error; err != nil {
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", outgoingItemId).First(&previousOutgoingItem).Error; err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
@@ -258,9 +567,44 @@ func CancelOutgoingItem(c *gin.Context) {
 		return
 	}
 
-	previousQty := previousOutgoingItem.Qty
+	if previousOutgoingItem.Status == "cancelled" {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Outgoing Item Already Cancelled",
+		})
+
+		return
+	}
 
-	if err := tx.Debug().Model(&previousOutgoingItem).Update("status", "cancelled").Error; err != nil {
+	// the sales order is locked before the product, like every document, and no longer counts the item as shipped
+	if previousOutgoingItem.SalesOrderLineID != nil {
+		SalesOrder, SalesOrderLine, err := lockSalesOrderLine(tx, *previousOutgoingItem.SalesOrderLineID)
+
+		if err == nil {
+			err = shipSalesOrderLine(tx, SalesOrder, SalesOrderLine, previousOutgoingItem.BaseQty.Neg())
+		}
+
+		if err != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	before := previousOutgoingItem
+
+	userID := helpers.GetUserID(c)
+
+	if err := tx.Debug().Model(&previousOutgoingItem).Updates(map[string]interface{}{
+		"status":          "cancelled",
+		"cancelled_by_id": userID,
+		"cancelled_at":    time.Now(),
+	}).Error; err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
@@ -270,34 +614,58 @@ func CancelOutgoingItem(c *gin.Context) {
 		return
 	}
 
-	diff := previousQty
+	// return the stock to the lots it was issued from
+	if _, err := returnStock(c, tx, models.StockMovements{
+		ProductID:   previousOutgoingItem.ProductID,
+		WarehouseID: previousOutgoingItem.WarehouseID,
+		SourceType:  models.MovementSourceOutgoingItem,
+		SourceID:    previousOutgoingItem.ID,
+		Action:      models.MovementActionCancelled,
+	}, nil); err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
+
+		return
+	}
+
+	if err := returnSerials(c, tx, models.SerialMovements{
+		SourceType: models.MovementSourceOutgoingItem,
+		SourceID:   previousOutgoingItem.ID,
+		Action:     models.MovementActionCancelled,
+	}); err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
+
+		return
+	}
+
+	// items issued after this one may have drawn other layers now
+	costs, err := costing.Recost(tx, previousOutgoingItem.ProductID, models.MovementSourceOutgoingItem, previousOutgoingItem.ID)
 
-	Product := models.Products{}
-	if err := tx.Debug().Where("id = ?", previousOutgoingItem.ProductID).First(&Product).Error; err != nil {
+	if err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Product Not Found",
+			"message": err.Error(),
 		})
 
 		return
 	}
 
-	newStock := Product.Stock + diff
+	costOfGoods := costs[previousOutgoingItem.ID]
+	previousOutgoingItem.CostOfGoods = &costOfGoods
 
-	if newStock < 0 {
+	if err := outbox.Record(tx, models.EventOutgoingItemCancelled, previousOutgoingItem.ProductID, previousOutgoingItem); err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
-			"message": "Stock of Product Can't be Negative",
+			"message": err.Error(),
 		})
 
 		return
 	}
 
-	Product.Stock = newStock
-
-	if err := tx.Debug().Save(&Product).Error; err != nil {
+	if err := recordAudit(c, tx, models.AuditActionCancel, models.AuditEntityOutgoingItem, previousOutgoingItem.ID, before, previousOutgoingItem); err != nil {
 		tx.Rollback()
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
@@ -307,7 +675,14 @@ func CancelOutgoingItem(c *gin.Context) {
 		return
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
 
 	OutgoingItem := models.OutgoingItems{}
 
@@ -320,7 +695,7 @@ func CancelOutgoingItem(c *gin.Context) {
 		return
 	}
 
-	if err := db.Debug().Preload("Products").Preload("Users").First(&OutgoingItem, outgoingItemId).Error; err != nil {
+	if err := db.Debug().Preload("Products").Preload("Users").Preload("Warehouses").First(&OutgoingItem, outgoingItemId).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -0,0 +1,101 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"inventoryapp/database"
+	"inventoryapp/models"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+func TestParallelOutgoingItemsNeverOversell(t *testing.T) {
+	requireDB(t)
+
+	const stock, requests = 10, 25
+
+	token := signIn(t, models.RoleClerk)
+	Warehouse := createWarehouse(t)
+
+	response := call(t, http.MethodPost, "/products/", token, gin.H{
+		"name":         "Concurrency Test Product",
+		"unit":         models.UnitPieces,
+		"stock":        stock,
+		"warehouse_id": Warehouse.ID,
+	})
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("creating the product answered %d: %s", response.Code, response.Body)
+	}
+
+	Product := models.Products{}
+
+	if err := json.Unmarshal(response.Body.Bytes(), &Product); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, requests)
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			codes <- call(t, http.MethodPost, "/outgoing-items/", token, gin.H{
+				"product_id":   Product.ID,
+				"warehouse_id": Warehouse.ID,
+				"qty":          1,
+				"outgoing_at":  "2026-01-02",
+			}).Code
+		}()
+	}
+
+	wg.Wait()
+	close(codes)
+
+	shipped := 0
+
+	for code := range codes {
+		if code == http.StatusOK {
+			shipped++
+		}
+	}
+
+	if shipped != stock {
+		t.Fatalf("%d of %d parallel outgoing items went through, want %d", shipped, requests, stock)
+	}
+
+	db := database.GetDB()
+
+	if err := db.First(&Product, Product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ProductStock := models.ProductStocks{}
+
+	if err := db.Where("product_id = ? AND warehouse_id = ?", Product.ID, Warehouse.ID).First(&ProductStock).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var ledger decimal.Decimal
+
+	if err := db.Model(&models.StockMovements{}).Where("product_id = ?", Product.ID).Select("COALESCE(SUM(qty), 0)").Scan(&ledger).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if !Product.Stock.IsZero() || !ProductStock.Stock.IsZero() || !ledger.IsZero() {
+		t.Fatalf("stock is %s, %s in the warehouse and %s in the ledger after shipping everything", Product.Stock, ProductStock.Stock, ledger)
+	}
+
+	var items int64
+	db.Model(&models.OutgoingItems{}).Where("product_id = ?", Product.ID).Count(&items)
+
+	if items != int64(stock) {
+		t.Fatalf("%d outgoing items were stored, want %d", items, stock)
+	}
+}
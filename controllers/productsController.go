@@ -2,13 +2,16 @@ package controllers
 
 import (
 	"gorm.io/gorm"
+	"inventoryapp/costing"
 	"inventoryapp/database"
 	"inventoryapp/helpers"
 	"inventoryapp/models"
+	"inventoryapp/outbox"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 )
 
 func GetProducts(c *gin.Context) {
@@ -28,7 +31,10 @@ func GetProducts(c *gin.Context) {
 			return
 		}
 
-		result := db.Where("id = ?", id).Find(&products)
+		// single product comes with its balance per warehouse, Stock stays the total over all of them
+		result := db.Where("id = ?", id).Preload("Stocks.Warehouses", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).Find(&products)
 		count := result.RowsAffected
 		if result.Error != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
@@ -48,7 +54,33 @@ func GetProducts(c *gin.Context) {
 			return
 		}
 
-		c.JSON(http.StatusOK, products[0])
+		// stock on the road between warehouses isn't part of any warehouse balance
+		inTransit := decimal.Zero
+		if err := db.Model(&models.TransferLines{}).
+			Select("COALESCE(SUM(transfer_lines.base_qty), 0)").
+			Joins("JOIN transfers ON transfers.id = transfer_lines.transfer_id").
+			Where("transfers.status = ? AND transfer_lines.product_id = ?", models.TransferStatusInTransit, id).
+			Scan(&inTransit).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+
+		products[0].InTransit = &inTransit
+
+		if err := fillAvailable(db, products); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, products[0].Response())
 		return
 	}
 
@@ -63,6 +95,16 @@ func GetProducts(c *gin.Context) {
 		return
 	}
 
+	// available is what is on hand minus what confirmed sales orders reserved
+	if err := fillAvailable(db, products); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
 	c.JSON(http.StatusOK, products)
 }
 
@@ -70,10 +112,25 @@ func UpdateProduct(c *gin.Context) {
 	db := database.GetDB()
 	contentType := helpers.GetContentType(c)
 
-	Product := models.Products{}
-
 	productId, _ := strconv.Atoi(c.Param("productId"))
 
+	tx := db.Begin()
+
+	previousProduct, err := lockProduct(tx, uint(productId))
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Product Not Found",
+		})
+
+		return
+	}
+
+	// the request is bound over the stored product, so fields left out keep their value
+	Product := previousProduct
+
 	if contentType == appJSON {
 		c.ShouldBindJSON(&Product)
 	} else {
@@ -82,9 +139,83 @@ func UpdateProduct(c *gin.Context) {
 
 	Product.ID = uint(productId)
 
-	err := db.Model(&Product).Where("id = ?", productId).Updates(models.Products{Name: Product.Name, Stock: Product.Stock}).Error
+	err = tx.Model(&Product).Where("id = ?", productId).Select("name", "allow_backorder", "cost_method", "reorder_point", "safety_stock", "reorder_qty").Updates(models.Products{Name: Product.Name, AllowBackorder: Product.AllowBackorder, CostMethod: Product.CostMethod, ReorderPoint: Product.ReorderPoint, SafetyStock: Product.SafetyStock, ReorderQty: Product.ReorderQty}).Error
 
 	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	// stock is a projection of the ledger, corrections go through a stock count so they leave a trace
+	if !Product.Stock.Equal(previousProduct.Stock) {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Stock can only be corrected through a stock count",
+		})
+
+		return
+	}
+
+	// the cost method may change at any time, the stored cost of goods is replayed under the new one
+	if Product.CostMethod != previousProduct.CostMethod {
+		if _, err := costing.RecostAll(tx, Product.ID); err != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	UpdatedProduct := models.Products{}
+	if err := tx.Debug().First(&UpdatedProduct, productId).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := outbox.Record(tx, models.EventProductUpdated, UpdatedProduct.ID, UpdatedProduct); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionUpdate, models.AuditEntityProduct, UpdatedProduct.ID, previousProduct, UpdatedProduct); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := db.Debug().First(&Product, productId).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -93,7 +224,7 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, Product)
+	c.JSON(http.StatusOK, Product.Response())
 }
 
 func DeleteProduct(c *gin.Context) {
@@ -111,37 +242,51 @@ func DeleteProduct(c *gin.Context) {
 
 	product := models.Products{}
 
+	if err := db.Debug().Where("id = ?", productId).First(&product).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
 	var incomingCount, outgoingCount int64
 	db.Model(&models.IncomingItems{}).Where("product_id = ?", productId).Count(&incomingCount)
 	db.Model(&models.OutgoingItems{}).Where("product_id = ?", productId).Count(&outgoingCount)
 
+	action := models.AuditActionDelete
 	if incomingCount > 0 || outgoingCount > 0 {
-		err := db.Debug().Where("id = ?", productId).First(&product).Error
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"error":   "Bad Request",
-				"message": err.Error(),
-			})
-			return
-		}
+		action = models.AuditActionArchive
+	}
 
-		err = db.Model(&product).Update("deleted_at", gorm.Expr("NOW()")).Error
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"error":   "Bad Request",
-				"message": err.Error(),
-			})
-			return
-		}
+	tx := db.Begin()
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Successfully archived product",
-			"product": product,
+	if action == models.AuditActionArchive {
+		err = tx.Model(&product).Update("deleted_at", gorm.Expr("NOW()")).Error
+	} else {
+		err = tx.Delete(&product).Error
+	}
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := recordAudit(c, tx, action, models.AuditEntityProduct, product.ID, product, nil); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
 		})
 		return
 	}
 
-	if err := db.Delete(&product).Error; err != nil {
+	if err := tx.Commit().Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"error":   "Internal Server Error",
 			"message": err.Error(),
@@ -149,6 +294,14 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
+	if action == models.AuditActionArchive {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Successfully archived product",
+			"product": product,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Successfully deleted product",
 		"product": product,
@@ -167,9 +320,92 @@ func CreateProduct(c *gin.Context) {
 		c.ShouldBind(&Product)
 	}
 
-	err := db.Debug().Create(&Product).Error
+	// opening stock is written to the ledger after the product exists
+	openingStock := Product.Stock
+	Product.Stock = decimal.Zero
+
+	tx := db.Begin()
+
+	err := tx.Debug().Create(&Product).Error
 
 	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := outbox.Record(tx, models.EventProductCreated, Product.ID, Product); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if !openingStock.IsZero() {
+		if Product.Serialized {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Stock of a serialized product is received through incoming items",
+			})
+
+			return
+		}
+
+		if Product.WarehouseID == 0 {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Warehouse id is required to adjust stock",
+			})
+
+			return
+		}
+
+		if !Product.IsWholeQty(openingStock) {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Stock must be a whole number of " + Product.Unit,
+			})
+
+			return
+		}
+
+		if _, err := receiveStock(c, tx, models.StockMovements{
+			ProductID:   Product.ID,
+			WarehouseID: Product.WarehouseID,
+			SourceType:  models.MovementSourceProduct,
+			SourceID:    Product.ID,
+			Action:      models.MovementActionAdjusted,
+		}, openingStock, "", nil); err != nil {
+			tx.Rollback()
+			abortWithStockError(c, err)
+
+			return
+		}
+
+		Product.Stock = openingStock
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntityProduct, Product.ID, nil, Product); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -178,7 +414,7 @@ func CreateProduct(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, Product)
+	c.JSON(http.StatusOK, Product.Response())
 }
 
 func HelloProduct(g *gin.Context) {
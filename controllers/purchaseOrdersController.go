@@ -0,0 +1,656 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// preparePurchaseOrderLines checks the supplier and normalizes every line to the base unit of its product
+func preparePurchaseOrderLines(tx *gorm.DB, PurchaseOrder *models.PurchaseOrders) error {
+	if len(PurchaseOrder.Lines) == 0 {
+		return errors.New("Purchase order needs at least one line")
+	}
+
+	if err := tx.Debug().Where("id = ?", PurchaseOrder.SupplierID).First(&models.Suppliers{}).Error; err != nil {
+		return errors.New("Supplier Not Found")
+	}
+
+	for i := range PurchaseOrder.Lines {
+		Line := &PurchaseOrder.Lines[i]
+
+		Product := models.Products{}
+		if err := tx.Debug().Where("id = ?", Line.ProductID).First(&Product).Error; err != nil {
+			return errors.New("Product Not Found")
+		}
+
+		baseQty, unit, err := toBaseQty(tx, Product, Line.Qty, Line.Unit)
+
+		if err != nil {
+			return err
+		}
+
+		Line.ID = 0
+		Line.PurchaseOrderID = PurchaseOrder.ID
+		Line.BaseQty, Line.Unit = baseQty, unit
+		Line.ReceivedQty = decimal.Zero
+	}
+
+	return nil
+}
+
+func lockPurchaseOrder(tx *gorm.DB, purchaseOrderId int) (models.PurchaseOrders, error) {
+	PurchaseOrder := models.PurchaseOrders{}
+	err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Lines").Where("id = ?", purchaseOrderId).First(&PurchaseOrder).Error
+
+	return PurchaseOrder, err
+}
+
+// lockPurchaseOrderLine locks the order of the line and then the line itself
+func lockPurchaseOrderLine(tx *gorm.DB, lineID uint) (models.PurchaseOrders, models.PurchaseOrderLines, error) {
+	PurchaseOrder := models.PurchaseOrders{}
+	Line := models.PurchaseOrderLines{}
+
+	if err := tx.Debug().Where("id = ?", lineID).First(&Line).Error; err != nil {
+		return PurchaseOrder, Line, errors.New("Purchase Order Line Not Found")
+	}
+
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", Line.PurchaseOrderID).First(&PurchaseOrder).Error; err != nil {
+		return PurchaseOrder, Line, errors.New("Purchase Order Not Found")
+	}
+
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", lineID).First(&Line).Error; err != nil {
+		return PurchaseOrder, Line, errors.New("Purchase Order Line Not Found")
+	}
+
+	return PurchaseOrder, Line, nil
+}
+
+// receivePurchaseOrderLine counts qty, in the base unit, as received on Line and refreshes the status of the order.
+// A negative qty takes a receipt back. A line takes at most TolerancePercent more than was ordered
+func receivePurchaseOrderLine(tx *gorm.DB, PurchaseOrder models.PurchaseOrders, Line models.PurchaseOrderLines, qty decimal.Decimal) error {
+	if qty.IsPositive() && (PurchaseOrder.Status == models.PurchaseOrderStatusCancelled || PurchaseOrder.ShortClosed) {
+		return errors.New("Purchase order is " + PurchaseOrder.Status)
+	}
+
+	receivedQty := Line.ReceivedQty.Add(qty)
+	maxQty := Line.BaseQty.Mul(decimal.NewFromInt(100).Add(PurchaseOrder.TolerancePercent)).Div(decimal.NewFromInt(100))
+
+	if qty.IsPositive() && receivedQty.GreaterThan(maxQty) {
+		return fmt.Errorf("Receipt exceeds the ordered quantity of product %d, at most %s more can be received", Line.ProductID, decimal.Max(maxQty.Sub(Line.ReceivedQty), decimal.Zero).String())
+	}
+
+	if err := tx.Debug().Model(&Line).Update("received_qty", receivedQty).Error; err != nil {
+		return err
+	}
+
+	return refreshPurchaseOrderStatus(tx, PurchaseOrder)
+}
+
+// refreshPurchaseOrderStatus derives the status of an order from what its lines received,
+// cancelled and short closed orders keep their status
+func refreshPurchaseOrderStatus(tx *gorm.DB, PurchaseOrder models.PurchaseOrders) error {
+	if PurchaseOrder.Status == models.PurchaseOrderStatusCancelled || PurchaseOrder.ShortClosed {
+		return nil
+	}
+
+	lines := []models.PurchaseOrderLines{}
+	if err := tx.Debug().Where("purchase_order_id = ?", PurchaseOrder.ID).Find(&lines).Error; err != nil {
+		return err
+	}
+
+	allReceived, anyReceived := true, false
+
+	for _, Line := range lines {
+		allReceived = allReceived && Line.ReceivedQty.GreaterThanOrEqual(Line.BaseQty)
+		anyReceived = anyReceived || Line.ReceivedQty.IsPositive()
+	}
+
+	changes := map[string]interface{}{"status": models.PurchaseOrderStatusOpen, "closed_at": nil}
+
+	if allReceived {
+		changes["status"] = models.PurchaseOrderStatusClosed
+		changes["closed_at"] = time.Now()
+
+		if PurchaseOrder.ClosedAt != nil {
+			changes["closed_at"] = *PurchaseOrder.ClosedAt
+		}
+	} else if anyReceived {
+		changes["status"] = models.PurchaseOrderStatusPartiallyReceived
+	}
+
+	return tx.Debug().Model(&PurchaseOrder).Updates(changes).Error
+}
+
+func preloadPurchaseOrder(db *gorm.DB) *gorm.DB {
+	unscoped := func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}
+
+	return db.Preload("Lines.Products", unscoped).Preload("Lines.IncomingItems").Preload("Suppliers", unscoped).Preload("Users")
+}
+
+// fillOutstanding sets what every line of the orders is still waiting for, over-receipt leaves nothing outstanding
+func fillOutstanding(purchaseOrders []models.PurchaseOrders) {
+	for i := range purchaseOrders {
+		for j := range purchaseOrders[i].Lines {
+			Line := &purchaseOrders[i].Lines[j]
+			outstanding := decimal.Max(Line.BaseQty.Sub(Line.ReceivedQty), decimal.Zero)
+			Line.OutstandingQty = &outstanding
+		}
+	}
+}
+
+func GetPurchaseOrders(c *gin.Context) {
+	db := database.GetDB()
+
+	purchaseOrders := []models.PurchaseOrders{}
+	purchaseOrderID := c.Param("purchaseOrderId")
+
+	if purchaseOrderID != "" {
+		id, err := strconv.Atoi(purchaseOrderID)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		result := preloadPurchaseOrder(db.Debug()).Where("id = ?", id).Find(&purchaseOrders)
+		count := result.RowsAffected
+
+		if result.Error != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		if count < 1 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Data Not Found",
+				"message": "Data Doesn't Exist",
+			})
+
+			return
+		}
+
+		fillOutstanding(purchaseOrders)
+
+		c.JSON(http.StatusOK, purchaseOrders[0])
+		return
+	}
+
+	query := db.Debug().Preload("Lines").Preload("Suppliers", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Users")
+
+	if supplierId := c.Query("supplier_id"); supplierId != "" {
+		query = query.Where("supplier_id = ?", supplierId)
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Find(&purchaseOrders).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	fillOutstanding(purchaseOrders)
+
+	c.JSON(http.StatusOK, purchaseOrders)
+}
+
+// respondPurchaseOrder answers with the order as it is after the change
+func respondPurchaseOrder(c *gin.Context, purchaseOrderID uint) {
+	db := database.GetDB()
+
+	purchaseOrders := []models.PurchaseOrders{{}}
+	if err := preloadPurchaseOrder(db.Debug()).First(&purchaseOrders[0], purchaseOrderID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	fillOutstanding(purchaseOrders)
+
+	c.JSON(http.StatusOK, purchaseOrders[0])
+}
+
+func CreatePurchaseOrder(c *gin.Context) {
+	db := database.GetDB()
+
+	PurchaseOrder := models.PurchaseOrders{}
+
+	if err := c.ShouldBindJSON(&PurchaseOrder); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	PurchaseOrder.Status = models.PurchaseOrderStatusOpen
+	PurchaseOrder.UserID = helpers.GetUserID(c)
+	PurchaseOrder.OrderedAt = time.Now()
+	PurchaseOrder.ShortClosed = false
+	PurchaseOrder.ClosedAt, PurchaseOrder.CancelledAt = nil, nil
+
+	tx := db.Begin()
+
+	if err := preparePurchaseOrderLines(tx, &PurchaseOrder); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Create(&PurchaseOrder).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionCreate, models.AuditEntityPurchaseOrder, PurchaseOrder.ID, nil, &models.PurchaseOrders{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	respondPurchaseOrder(c, PurchaseOrder.ID)
+}
+
+func UpdatePurchaseOrder(c *gin.Context) {
+	db := database.GetDB()
+
+	PurchaseOrder := models.PurchaseOrders{}
+	purchaseOrderId, err := strconv.Atoi(c.Param("purchaseOrderId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	if err := c.ShouldBindJSON(&PurchaseOrder); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	previousPurchaseOrder, err := lockPurchaseOrder(tx, purchaseOrderId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Purchase Order Not Found",
+		})
+
+		return
+	}
+
+	// once goods arrived against the order its lines are fixed
+	if previousPurchaseOrder.Status != models.PurchaseOrderStatusOpen {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Only open purchase orders without receipts can be changed",
+		})
+
+		return
+	}
+
+	before := previousPurchaseOrder
+	PurchaseOrder.ID = previousPurchaseOrder.ID
+
+	if err := preparePurchaseOrderLines(tx, &PurchaseOrder); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if PurchaseOrder.TolerancePercent.IsNegative() {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Your tolerance percent can't be negative",
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Model(&previousPurchaseOrder).Updates(map[string]interface{}{
+		"supplier_id":       PurchaseOrder.SupplierID,
+		"note":              PurchaseOrder.Note,
+		"tolerance_percent": PurchaseOrder.TolerancePercent,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	// nothing was received yet, so the lines are simply replaced
+	if err := tx.Debug().Where("purchase_order_id = ?", previousPurchaseOrder.ID).Delete(&models.PurchaseOrderLines{}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Create(&PurchaseOrder.Lines).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionUpdate, models.AuditEntityPurchaseOrder, previousPurchaseOrder.ID, before, &models.PurchaseOrders{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	respondPurchaseOrder(c, PurchaseOrder.ID)
+}
+
+// ReceivePurchaseOrder books the goods that arrived against the order, every entry becomes an incoming item
+// of the purchase order line it names
+func ReceivePurchaseOrder(c *gin.Context) {
+	db := database.GetDB()
+
+	purchaseOrderId, err := strconv.Atoi(c.Param("purchaseOrderId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	incomingItems := []models.IncomingItems{}
+
+	if err := helpers.BindWithoutUserID(c, &incomingItems); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if len(incomingItems) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Receipt needs at least one item",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	PurchaseOrder, err := lockPurchaseOrder(tx, purchaseOrderId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Purchase Order Not Found",
+		})
+
+		return
+	}
+
+	lineProducts := map[uint]uint{}
+	for _, Line := range PurchaseOrder.Lines {
+		lineProducts[Line.ID] = Line.ProductID
+	}
+
+	for i := range incomingItems {
+		IncomingItem := &incomingItems[i]
+
+		if IncomingItem.PurchaseOrderLineID == nil || lineProducts[*IncomingItem.PurchaseOrderLineID] == 0 {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Every item needs a purchase order line of this order",
+			})
+
+			return
+		}
+
+		IncomingItem.ProductID = lineProducts[*IncomingItem.PurchaseOrderLineID]
+	}
+
+	// items are booked in product order so two receipts never lock the same products the other way round
+	sort.SliceStable(incomingItems, func(i, j int) bool {
+		return incomingItems[i].ProductID < incomingItems[j].ProductID
+	})
+
+	for i := range incomingItems {
+		if err := bookIncomingItem(c, tx, &incomingItems[i]); err != nil {
+			tx.Rollback()
+			abortWithStockError(c, err)
+
+			return
+		}
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionReceive, models.AuditEntityPurchaseOrder, PurchaseOrder.ID, PurchaseOrder, &models.PurchaseOrders{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	respondPurchaseOrder(c, PurchaseOrder.ID)
+}
+
+// ClosePurchaseOrder closes an order that won't receive anything more, what is still outstanding is dropped
+func ClosePurchaseOrder(c *gin.Context) {
+	changePurchaseOrderStatus(c, models.PurchaseOrderStatusClosed, func(PurchaseOrder models.PurchaseOrders) error {
+		if PurchaseOrder.Status != models.PurchaseOrderStatusOpen && PurchaseOrder.Status != models.PurchaseOrderStatusPartiallyReceived {
+			return errors.New("Purchase order is " + PurchaseOrder.Status + " and can't become " + models.PurchaseOrderStatusClosed)
+		}
+
+		return nil
+	})
+}
+
+// CancelPurchaseOrder cancels an order nothing was received against yet, received orders can only be closed
+func CancelPurchaseOrder(c *gin.Context) {
+	changePurchaseOrderStatus(c, models.PurchaseOrderStatusCancelled, func(PurchaseOrder models.PurchaseOrders) error {
+		if PurchaseOrder.Status != models.PurchaseOrderStatusOpen {
+			return errors.New("Purchase order is " + PurchaseOrder.Status + " and can't become " + models.PurchaseOrderStatusCancelled)
+		}
+
+		for _, Line := range PurchaseOrder.Lines {
+			if !Line.ReceivedQty.IsZero() {
+				return errors.New("Purchase order has receipts, close it instead")
+			}
+		}
+
+		return nil
+	})
+}
+
+func changePurchaseOrderStatus(c *gin.Context, next string, check func(PurchaseOrder models.PurchaseOrders) error) {
+	db := database.GetDB()
+
+	purchaseOrderId, err := strconv.Atoi(c.Param("purchaseOrderId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	PurchaseOrder, err := lockPurchaseOrder(tx, purchaseOrderId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Purchase Order Not Found",
+		})
+
+		return
+	}
+
+	if err := check(PurchaseOrder); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	now := time.Now()
+	before := PurchaseOrder
+	changes := map[string]interface{}{"status": next}
+	action := ""
+
+	switch next {
+	case models.PurchaseOrderStatusClosed:
+		changes["short_closed"] = true
+		changes["closed_at"] = now
+		action = models.AuditActionClose
+	case models.PurchaseOrderStatusCancelled:
+		changes["cancelled_at"] = now
+		action = models.AuditActionCancel
+	}
+
+	if err := tx.Debug().Model(&PurchaseOrder).Updates(changes).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, action, models.AuditEntityPurchaseOrder, PurchaseOrder.ID, before, &models.PurchaseOrders{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	respondPurchaseOrder(c, PurchaseOrder.ID)
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"inventoryapp/costing"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// GetValuationReport values the stock of every product at as_of, a date counts up to the end of that day
+func GetValuationReport(c *gin.Context) {
+	db := database.GetDB()
+
+	asOf := time.Now()
+
+	if asOfParam := c.Query("as_of"); asOfParam != "" {
+		if date, err := time.ParseInLocation("2006-01-02", asOfParam, time.Local); err == nil {
+			asOf = date.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		} else if asOf, err = time.Parse(time.RFC3339, asOfParam); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+	}
+
+	products := []models.Products{}
+	query := db.Debug().Unscoped().Order("id")
+
+	if productId := c.Query("product_id"); productId != "" {
+		query = query.Where("id = ?", productId)
+	}
+
+	if err := query.Find(&products).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	Valuation := helpers.ValuationResponse{
+		AsOf:       asOf,
+		TotalValue: decimal.Zero,
+		Products:   []helpers.ProductValuationResponse{},
+	}
+
+	for _, Product := range products {
+		Costs, err := costing.Value(db, Product, asOf)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+
+		if Costs.Qty.IsZero() && Costs.Value.IsZero() {
+			continue
+		}
+
+		unitCost := decimal.Zero
+		if !Costs.Qty.IsZero() {
+			unitCost = Costs.Value.Div(Costs.Qty).Round(6)
+		}
+
+		Valuation.Products = append(Valuation.Products, helpers.ProductValuationResponse{
+			ProductID:  Product.ID,
+			Name:       Product.Name,
+			Unit:       Product.Unit,
+			CostMethod: Product.CostMethod,
+			Qty:        Costs.Qty,
+			UnitCost:   unitCost,
+			Value:      Costs.Value,
+		})
+
+		Valuation.TotalValue = Valuation.TotalValue.Add(Costs.Value)
+	}
+
+	c.JSON(http.StatusOK, Valuation)
+}
+
+// GetLowStockReport lists the products below their reorder point together with what is already on order
+func GetLowStockReport(c *gin.Context) {
+	db := database.GetDB()
+
+	products := []models.Products{}
+	if err := db.Debug().Where("reorder_point > 0 AND stock < reorder_point").Order("id").Find(&products).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	productIDs := make([]uint, 0, len(products))
+	for _, Product := range products {
+		productIDs = append(productIDs, Product.ID)
+	}
+
+	onOrder := []struct {
+		ProductID uint
+		Qty       decimal.Decimal
+	}{}
+
+	if len(productIDs) > 0 {
+		if err := db.Debug().Model(&models.PurchaseOrderLines{}).
+			Select("purchase_order_lines.product_id, COALESCE(SUM(GREATEST(purchase_order_lines.base_qty - purchase_order_lines.received_qty, 0)), 0) AS qty").
+			Joins("JOIN purchase_orders ON purchase_orders.id = purchase_order_lines.purchase_order_id").
+			Where("purchase_orders.status IN ? AND purchase_order_lines.product_id IN ?", []string{models.PurchaseOrderStatusOpen, models.PurchaseOrderStatusPartiallyReceived}, productIDs).
+			Group("purchase_order_lines.product_id").
+			Scan(&onOrder).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	onOrderByProduct := map[uint]decimal.Decimal{}
+	for _, OnOrder := range onOrder {
+		onOrderByProduct[OnOrder.ProductID] = OnOrder.Qty
+	}
+
+	report := []helpers.LowStockResponse{}
+
+	for _, Product := range products {
+		ordered := onOrderByProduct[Product.ID]
+		suggestedQty := decimal.Zero
+
+		if shortfall := Product.ReorderPoint.Sub(Product.Stock).Sub(ordered); shortfall.IsPositive() {
+			suggestedQty = decimal.Max(shortfall, Product.ReorderQty)
+		}
+
+		report = append(report, helpers.LowStockResponse{
+			ProductID:        Product.ID,
+			Name:             Product.Name,
+			Unit:             Product.Unit,
+			Stock:            Product.Stock,
+			ReorderPoint:     Product.ReorderPoint,
+			SafetyStock:      Product.SafetyStock,
+			ReorderQty:       Product.ReorderQty,
+			OnOrder:          ordered,
+			BelowSafetyStock: Product.Stock.LessThan(Product.SafetyStock),
+			SuggestedQty:     suggestedQty,
+		})
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,111 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// findPassword answers the path of the first password key in the JSON value, empty when there is none
+func findPassword(value interface{}, path string) string {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if strings.EqualFold(key, "password") {
+				return path + "." + key
+			}
+
+			if found := findPassword(child, path+"."+key); found != "" {
+				return found
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			if found := findPassword(child, path+"["+strconv.Itoa(i)+"]"); found != "" {
+				return found
+			}
+		}
+	}
+
+	return ""
+}
+
+func scanForPassword(t *testing.T, endpoint string, body []byte) {
+	t.Helper()
+
+	var value interface{}
+
+	if err := json.Unmarshal(body, &value); err != nil {
+		t.Errorf("%s didn't answer JSON: %s", endpoint, body)
+		return
+	}
+
+	if found := findPassword(value, "$"); found != "" {
+		t.Errorf("%s answered a password at %s", endpoint, found)
+	}
+}
+
+func TestNoResponseContainsAPassword(t *testing.T) {
+	requireDB(t)
+
+	// a user signs up and in, the way everyone's password passes through the API
+	name := "test_" + helpers.RandomToken(4)
+	credentials := gin.H{"username": name, "email": name + "@example.com", "password": "correct horse battery"}
+
+	response := call(t, http.MethodPost, "/users/register", "", credentials)
+	scanForPassword(t, "POST /users/register", response.Body.Bytes())
+
+	response = call(t, http.MethodPost, "/users/login", "", credentials)
+	scanForPassword(t, "POST /users/login", response.Body.Bytes())
+
+	// the admin books something, so the listings have users preloaded into them
+	token := signIn(t, models.RoleAdmin)
+	Warehouse := createWarehouse(t)
+
+	response = call(t, http.MethodPost, "/products/", token, gin.H{"name": "Password Scan Product", "stock": 5, "warehouse_id": Warehouse.ID})
+	scanForPassword(t, "POST /products/", response.Body.Bytes())
+
+	Product := models.Products{}
+	json.Unmarshal(response.Body.Bytes(), &Product)
+
+	response = call(t, http.MethodPost, "/outgoing-items/", token, gin.H{"product_id": Product.ID, "warehouse_id": Warehouse.ID, "qty": 1, "outgoing_at": "2026-01-02"})
+	scanForPassword(t, "POST /outgoing-items/", response.Body.Bytes())
+
+	OutgoingItem := models.OutgoingItems{}
+	json.Unmarshal(response.Body.Bytes(), &OutgoingItem)
+
+	response = call(t, http.MethodPost, "/service-accounts/", token, gin.H{"username": "svc_" + helpers.RandomToken(4), "role": models.RoleViewer})
+	scanForPassword(t, "POST /service-accounts/", response.Body.Bytes())
+
+	ids := map[string]string{
+		":productId":      strconv.Itoa(int(Product.ID)),
+		":warehouseId":    strconv.Itoa(int(Warehouse.ID)),
+		":outgoingItemId": strconv.Itoa(int(OutgoingItem.ID)),
+	}
+	param := regexp.MustCompile(`:[A-Za-z]+`)
+
+	for _, route := range server.Routes() {
+		// the event stream never ends and swagger isn't ours
+		if route.Method != http.MethodGet || route.Path == "/events/stream" || strings.HasPrefix(route.Path, "/swagger") {
+			continue
+		}
+
+		path := param.ReplaceAllStringFunc(route.Path, func(name string) string {
+			if id, ok := ids[name]; ok {
+				return id
+			}
+
+			return "1"
+		})
+
+		response := call(t, http.MethodGet, path, token, nil)
+		scanForPassword(t, route.Method+" "+route.Path, response.Body.Bytes())
+	}
+}
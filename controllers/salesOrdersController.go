@@ -0,0 +1,866 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// prepareSalesOrderLines checks customer and warehouse and normalizes every line to the base unit of its product
+func prepareSalesOrderLines(tx *gorm.DB, SalesOrder *models.SalesOrders) error {
+	if len(SalesOrder.Lines) == 0 {
+		return errors.New("Sales order needs at least one line")
+	}
+
+	if err := tx.Debug().Where("id = ?", SalesOrder.CustomerID).First(&models.Customers{}).Error; err != nil {
+		return errors.New("Customer Not Found")
+	}
+
+	if err := tx.Debug().Where("id = ?", SalesOrder.WarehouseID).First(&models.Warehouses{}).Error; err != nil {
+		return errors.New("Warehouse Not Found")
+	}
+
+	for i := range SalesOrder.Lines {
+		Line := &SalesOrder.Lines[i]
+
+		Product := models.Products{}
+		if err := tx.Debug().Where("id = ?", Line.ProductID).First(&Product).Error; err != nil {
+			return errors.New("Product Not Found")
+		}
+
+		baseQty, unit, err := toBaseQty(tx, Product, Line.Qty, Line.Unit)
+
+		if err != nil {
+			return err
+		}
+
+		Line.ID = 0
+		Line.SalesOrderID = SalesOrder.ID
+		Line.BaseQty, Line.Unit = baseQty, unit
+		Line.ShippedQty = decimal.Zero
+	}
+
+	return nil
+}
+
+func lockSalesOrder(tx *gorm.DB, salesOrderId int) (models.SalesOrders, error) {
+	SalesOrder := models.SalesOrders{}
+	err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Lines").Where("id = ?", salesOrderId).First(&SalesOrder).Error
+
+	return SalesOrder, err
+}
+
+// lockSalesOrderLine locks the order of the line and then the line itself
+func lockSalesOrderLine(tx *gorm.DB, lineID uint) (models.SalesOrders, models.SalesOrderLines, error) {
+	SalesOrder := models.SalesOrders{}
+	Line := models.SalesOrderLines{}
+
+	if err := tx.Debug().Where("id = ?", lineID).First(&Line).Error; err != nil {
+		return SalesOrder, Line, errors.New("Sales Order Line Not Found")
+	}
+
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", Line.SalesOrderID).First(&SalesOrder).Error; err != nil {
+		return SalesOrder, Line, errors.New("Sales Order Not Found")
+	}
+
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", lineID).First(&Line).Error; err != nil {
+		return SalesOrder, Line, errors.New("Sales Order Line Not Found")
+	}
+
+	return SalesOrder, Line, nil
+}
+
+// isReserving tells whether the order still holds on to what it hasn't shipped
+func isReserving(SalesOrder models.SalesOrders) bool {
+	for _, status := range models.SalesOrderReservingStatuses {
+		if SalesOrder.Status == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shipSalesOrderLine counts qty, in the base unit, as shipped on Line and refreshes the status of the order.
+// A negative qty takes a shipment back. A line never ships more than was ordered
+func shipSalesOrderLine(tx *gorm.DB, SalesOrder models.SalesOrders, Line models.SalesOrderLines, qty decimal.Decimal) error {
+	if qty.IsPositive() && !isReserving(SalesOrder) {
+		return errors.New("Sales order is " + SalesOrder.Status)
+	}
+
+	shippedQty := Line.ShippedQty.Add(qty)
+
+	if qty.IsPositive() && shippedQty.GreaterThan(Line.BaseQty) {
+		return fmt.Errorf("Shipment exceeds the ordered quantity of product %d, at most %s more can be shipped", Line.ProductID, decimal.Max(Line.BaseQty.Sub(Line.ShippedQty), decimal.Zero).String())
+	}
+
+	if err := tx.Debug().Model(&Line).Update("shipped_qty", shippedQty).Error; err != nil {
+		return err
+	}
+
+	return refreshSalesOrderStatus(tx, SalesOrder)
+}
+
+// refreshSalesOrderStatus derives the status of a confirmed order from what its lines shipped,
+// drafts and cancelled orders keep their status
+func refreshSalesOrderStatus(tx *gorm.DB, SalesOrder models.SalesOrders) error {
+	if SalesOrder.Status == models.SalesOrderStatusDraft || SalesOrder.Status == models.SalesOrderStatusCancelled {
+		return nil
+	}
+
+	lines := []models.SalesOrderLines{}
+	if err := tx.Debug().Where("sales_order_id = ?", SalesOrder.ID).Find(&lines).Error; err != nil {
+		return err
+	}
+
+	allShipped, anyShipped := true, false
+
+	for _, Line := range lines {
+		allShipped = allShipped && Line.ShippedQty.GreaterThanOrEqual(Line.BaseQty)
+		anyShipped = anyShipped || Line.ShippedQty.IsPositive()
+	}
+
+	changes := map[string]interface{}{"status": models.SalesOrderStatusConfirmed, "shipped_at": nil}
+
+	if allShipped {
+		changes["status"] = models.SalesOrderStatusShipped
+		changes["shipped_at"] = time.Now()
+
+		if SalesOrder.ShippedAt != nil {
+			changes["shipped_at"] = *SalesOrder.ShippedAt
+		}
+	} else if anyShipped {
+		changes["status"] = models.SalesOrderStatusPartiallyShipped
+	}
+
+	return tx.Debug().Model(&SalesOrder).Updates(changes).Error
+}
+
+// reservedStock is the query of what confirmed orders haven't shipped yet per product and warehouse
+func reservedStock(db *gorm.DB) *gorm.DB {
+	return db.Debug().Model(&models.SalesOrderLines{}).
+		Select("sales_order_lines.product_id, sales_orders.warehouse_id, COALESCE(SUM(sales_order_lines.base_qty - sales_order_lines.shipped_qty), 0) AS qty").
+		Joins("JOIN sales_orders ON sales_orders.id = sales_order_lines.sales_order_id").
+		Where("sales_orders.status IN ?", models.SalesOrderReservingStatuses).
+		Group("sales_order_lines.product_id, sales_orders.warehouse_id")
+}
+
+// availableStock is what of the product in the warehouse sales orders haven't reserved, negative when they
+// reserved more than there is
+func availableStock(tx *gorm.DB, productID uint, warehouseID uint) (decimal.Decimal, error) {
+	stock := decimal.Zero
+	if err := tx.Debug().Model(&models.ProductStocks{}).
+		Select("COALESCE(SUM(stock), 0)").
+		Where("product_id = ? AND warehouse_id = ?", productID, warehouseID).
+		Scan(&stock).Error; err != nil {
+		return stock, err
+	}
+
+	reserved := []struct {
+		ProductID   uint
+		WarehouseID uint
+		Qty         decimal.Decimal
+	}{}
+
+	if err := reservedStock(tx).
+		Where("sales_order_lines.product_id = ? AND sales_orders.warehouse_id = ?", productID, warehouseID).
+		Scan(&reserved).Error; err != nil {
+		return stock, err
+	}
+
+	available := stock
+
+	for _, Reserved := range reserved {
+		available = available.Sub(Reserved.Qty)
+	}
+
+	return available, nil
+}
+
+// checkAvailable makes sure qty of the product can leave the warehouse without touching what sales orders reserved,
+// a product that allows backorders may always go
+func checkAvailable(tx *gorm.DB, Product models.Products, warehouseID uint, qty decimal.Decimal) error {
+	if Product.AllowBackorder {
+		return nil
+	}
+
+	return checkOnHand(tx, Product, warehouseID, qty)
+}
+
+// checkOnHand makes sure qty of the product is on hand in the warehouse besides what sales orders reserved,
+// whether the product allows backorders or not
+func checkOnHand(tx *gorm.DB, Product models.Products, warehouseID uint, qty decimal.Decimal) error {
+	available, err := availableStock(tx, Product.ID, warehouseID)
+
+	if err != nil {
+		return err
+	}
+
+	if qty.GreaterThan(available) {
+		return &InsufficientStockError{
+			ProductID:   Product.ID,
+			WarehouseID: warehouseID,
+			Requested:   qty,
+			Available:   decimal.Max(available, decimal.Zero),
+		}
+	}
+
+	return nil
+}
+
+// fillAvailable sets how much of every product, and of its warehouse balances when loaded, sales orders reserved
+// and how much is still available to promise
+func fillAvailable(db *gorm.DB, products []models.Products) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	productIDs := make([]uint, 0, len(products))
+	for _, Product := range products {
+		productIDs = append(productIDs, Product.ID)
+	}
+
+	reserved := []struct {
+		ProductID   uint
+		WarehouseID uint
+		Qty         decimal.Decimal
+	}{}
+
+	if err := reservedStock(db).Where("sales_order_lines.product_id IN ?", productIDs).Scan(&reserved).Error; err != nil {
+		return err
+	}
+
+	byProduct := map[uint]decimal.Decimal{}
+	byWarehouse := map[[2]uint]decimal.Decimal{}
+
+	for _, Reserved := range reserved {
+		byProduct[Reserved.ProductID] = byProduct[Reserved.ProductID].Add(Reserved.Qty)
+		byWarehouse[[2]uint{Reserved.ProductID, Reserved.WarehouseID}] = Reserved.Qty
+	}
+
+	for i := range products {
+		Product := &products[i]
+
+		productReserved := byProduct[Product.ID]
+		productAvailable := Product.Stock.Sub(productReserved)
+		Product.Reserved, Product.Available = &productReserved, &productAvailable
+
+		for j := range Product.Stocks {
+			ProductStock := &Product.Stocks[j]
+
+			stockReserved := byWarehouse[[2]uint{Product.ID, ProductStock.WarehouseID}]
+			stockAvailable := ProductStock.Stock.Sub(stockReserved)
+			ProductStock.Reserved, ProductStock.Available = &stockReserved, &stockAvailable
+		}
+	}
+
+	return nil
+}
+
+func preloadSalesOrder(db *gorm.DB) *gorm.DB {
+	unscoped := func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}
+
+	return db.Preload("Lines.Products", unscoped).Preload("Lines.OutgoingItems").Preload("Customers", unscoped).Preload("Warehouses", unscoped).Preload("Users")
+}
+
+func GetSalesOrders(c *gin.Context) {
+	db := database.GetDB()
+
+	salesOrders := []models.SalesOrders{}
+	salesOrderID := c.Param("salesOrderId")
+
+	if salesOrderID != "" {
+		id, err := strconv.Atoi(salesOrderID)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		result := preloadSalesOrder(db.Debug()).Where("id = ?", id).Find(&salesOrders)
+		count := result.RowsAffected
+
+		if result.Error != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		if count < 1 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Data Not Found",
+				"message": "Data Doesn't Exist",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, salesOrders[0])
+		return
+	}
+
+	query := db.Debug().Preload("Lines").Preload("Customers", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Users")
+
+	if customerId := c.Query("customer_id"); customerId != "" {
+		query = query.Where("customer_id = ?", customerId)
+	}
+
+	if warehouseId := c.Query("warehouse_id"); warehouseId != "" {
+		query = query.Where("warehouse_id = ?", warehouseId)
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Find(&salesOrders).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, salesOrders)
+}
+
+// respondSalesOrder answers with the order as it is after the change
+func respondSalesOrder(c *gin.Context, salesOrderID uint) {
+	db := database.GetDB()
+
+	SalesOrder := models.SalesOrders{}
+	if err := preloadSalesOrder(db.Debug()).First(&SalesOrder, salesOrderID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, SalesOrder)
+}
+
+// CreateSalesOrder creates a draft, nothing is reserved before the order is confirmed
+func CreateSalesOrder(c *gin.Context) {
+	db := database.GetDB()
+
+	SalesOrder := models.SalesOrders{}
+
+	if err := c.ShouldBindJSON(&SalesOrder); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	SalesOrder.Status = models.SalesOrderStatusDraft
+	SalesOrder.UserID = helpers.GetUserID(c)
+	SalesOrder.ConfirmedAt, SalesOrder.ShippedAt, SalesOrder.CancelledAt = nil, nil, nil
+
+	tx := db.Begin()
+
+	if err := prepareSalesOrderLines(tx, &SalesOrder); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Create(&SalesOrder).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionCreate, models.AuditEntitySalesOrder, SalesOrder.ID, nil, &models.SalesOrders{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	respondSalesOrder(c, SalesOrder.ID)
+}
+
+func UpdateSalesOrder(c *gin.Context) {
+	db := database.GetDB()
+
+	SalesOrder := models.SalesOrders{}
+	salesOrderId, err := strconv.Atoi(c.Param("salesOrderId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	if err := c.ShouldBindJSON(&SalesOrder); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	previousSalesOrder, err := lockSalesOrder(tx, salesOrderId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Sales Order Not Found",
+		})
+
+		return
+	}
+
+	// a confirmed order holds stock, its lines only change by cancelling it and ordering again
+	if previousSalesOrder.Status != models.SalesOrderStatusDraft {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Only draft sales orders can be changed",
+		})
+
+		return
+	}
+
+	before := previousSalesOrder
+	SalesOrder.ID = previousSalesOrder.ID
+
+	if err := prepareSalesOrderLines(tx, &SalesOrder); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Model(&previousSalesOrder).Updates(map[string]interface{}{
+		"customer_id":  SalesOrder.CustomerID,
+		"warehouse_id": SalesOrder.WarehouseID,
+		"note":         SalesOrder.Note,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	// nothing was shipped from a draft, so the lines are simply replaced
+	if err := tx.Debug().Where("sales_order_id = ?", previousSalesOrder.ID).Delete(&models.SalesOrderLines{}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Create(&SalesOrder.Lines).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionUpdate, models.AuditEntitySalesOrder, previousSalesOrder.ID, before, &models.SalesOrders{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	respondSalesOrder(c, SalesOrder.ID)
+}
+
+// ConfirmSalesOrder reserves the lines of a draft, every product must have enough available in the warehouse
+// unless it allows backorders
+func ConfirmSalesOrder(c *gin.Context) {
+	db := database.GetDB()
+
+	salesOrderId, err := strconv.Atoi(c.Param("salesOrderId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	SalesOrder, err := lockSalesOrder(tx, salesOrderId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Sales Order Not Found",
+		})
+
+		return
+	}
+
+	if SalesOrder.Status != models.SalesOrderStatusDraft {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Sales order is " + SalesOrder.Status + " and can't become " + models.SalesOrderStatusConfirmed,
+		})
+
+		return
+	}
+
+	// lines of the same product reserve together, products are locked in order
+	// so two confirmations never lock the same products the other way round
+	ordered := map[uint]decimal.Decimal{}
+	productIDs := []uint{}
+
+	for _, Line := range SalesOrder.Lines {
+		if _, ok := ordered[Line.ProductID]; !ok {
+			productIDs = append(productIDs, Line.ProductID)
+		}
+
+		ordered[Line.ProductID] = ordered[Line.ProductID].Add(Line.BaseQty)
+	}
+
+	sort.Slice(productIDs, func(i, j int) bool {
+		return productIDs[i] < productIDs[j]
+	})
+
+	for _, productID := range productIDs {
+		Product, err := lockProduct(tx, productID)
+
+		if err != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Product Not Found",
+			})
+
+			return
+		}
+
+		if err := checkAvailable(tx, Product, SalesOrder.WarehouseID, ordered[productID]); err != nil {
+			tx.Rollback()
+			abortWithStockError(c, err)
+
+			return
+		}
+	}
+
+	before := SalesOrder
+
+	if err := tx.Debug().Model(&SalesOrder).Updates(map[string]interface{}{
+		"status":       models.SalesOrderStatusConfirmed,
+		"confirmed_at": time.Now(),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionConfirm, models.AuditEntitySalesOrder, SalesOrder.ID, before, &models.SalesOrders{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	respondSalesOrder(c, SalesOrder.ID)
+}
+
+// ShipSalesOrder ships the order, every entry becomes an outgoing item of the sales order line it names
+// and consumes its reservation. Without entries everything outstanding is shipped
+func ShipSalesOrder(c *gin.Context) {
+	db := database.GetDB()
+
+	salesOrderId, err := strconv.Atoi(c.Param("salesOrderId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	outgoingItems := []models.OutgoingItems{}
+
+	if c.Request.ContentLength != 0 {
+		if err := helpers.BindWithoutUserID(c, &outgoingItems); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	tx := db.Begin()
+
+	SalesOrder, err := lockSalesOrder(tx, salesOrderId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Sales Order Not Found",
+		})
+
+		return
+	}
+
+	if !isReserving(SalesOrder) {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Sales order is " + SalesOrder.Status,
+		})
+
+		return
+	}
+
+	lineProducts := map[uint]uint{}
+	for _, Line := range SalesOrder.Lines {
+		lineProducts[Line.ID] = Line.ProductID
+	}
+
+	if len(outgoingItems) == 0 {
+		for _, Line := range SalesOrder.Lines {
+			if outstanding := Line.BaseQty.Sub(Line.ShippedQty); outstanding.IsPositive() {
+				lineID := Line.ID
+				outgoingItems = append(outgoingItems, models.OutgoingItems{
+					Qty:              outstanding,
+					SalesOrderLineID: &lineID,
+				})
+			}
+		}
+	}
+
+	for i := range outgoingItems {
+		OutgoingItem := &outgoingItems[i]
+
+		if OutgoingItem.SalesOrderLineID == nil || lineProducts[*OutgoingItem.SalesOrderLineID] == 0 {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Every item needs a sales order line of this order",
+			})
+
+			return
+		}
+
+		OutgoingItem.ProductID = lineProducts[*OutgoingItem.SalesOrderLineID]
+
+		if OutgoingItem.OutgoingAt.IsZero() {
+			OutgoingItem.OutgoingAt = models.CustomTime{Time: time.Now()}
+		}
+	}
+
+	// items are booked in product order so two shipments never lock the same products the other way round
+	sort.SliceStable(outgoingItems, func(i, j int) bool {
+		return outgoingItems[i].ProductID < outgoingItems[j].ProductID
+	})
+
+	for i := range outgoingItems {
+		if err := bookOutgoingItem(c, tx, &outgoingItems[i]); err != nil {
+			tx.Rollback()
+			abortWithStockError(c, err)
+
+			return
+		}
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionShip, models.AuditEntitySalesOrder, SalesOrder.ID, SalesOrder, &models.SalesOrders{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	respondSalesOrder(c, SalesOrder.ID)
+}
+
+// CancelSalesOrder cancels an order that isn't fully shipped, whatever it still reserved is released.
+// Items already shipped stay, they are cancelled on their own
+func CancelSalesOrder(c *gin.Context) {
+	db := database.GetDB()
+
+	salesOrderId, err := strconv.Atoi(c.Param("salesOrderId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	SalesOrder, err := lockSalesOrder(tx, salesOrderId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Sales Order Not Found",
+		})
+
+		return
+	}
+
+	if SalesOrder.Status != models.SalesOrderStatusDraft && !isReserving(SalesOrder) {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Sales order is " + SalesOrder.Status + " and can't become " + models.SalesOrderStatusCancelled,
+		})
+
+		return
+	}
+
+	before := SalesOrder
+
+	// the reservation is derived from the status, leaving the reserving statuses releases it
+	if err := tx.Debug().Model(&SalesOrder).Updates(map[string]interface{}{
+		"status":       models.SalesOrderStatusCancelled,
+		"cancelled_at": time.Now(),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionCancel, models.AuditEntitySalesOrder, SalesOrder.ID, before, &models.SalesOrders{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	respondSalesOrder(c, SalesOrder.ID)
+}
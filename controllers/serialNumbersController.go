@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// checkSerials makes sure an item of Product with base quantity qty names one distinct serial per piece
+// when the product is serialized, and no serials at all when it isn't
+func checkSerials(Product models.Products, qty decimal.Decimal, serials []string) error {
+	if !Product.Serialized {
+		if len(serials) > 0 {
+			return errors.New("Product isn't serialized")
+		}
+
+		return nil
+	}
+
+	if !decimal.NewFromInt(int64(len(serials))).Equal(qty) {
+		return fmt.Errorf("Serialized product needs one serial per piece, got %d serials for %s pcs", len(serials), qty.String())
+	}
+
+	seen := map[string]bool{}
+
+	for _, serial := range serials {
+		if strings.TrimSpace(serial) == "" {
+			return errors.New("Serial can't be blank")
+		}
+
+		if seen[serial] {
+			return fmt.Errorf("Serial %s is given twice", serial)
+		}
+
+		seen[serial] = true
+	}
+
+	return nil
+}
+
+// lockSerials locks the serial numbers in serial order, the product they belong to must already be locked
+func lockSerials(tx *gorm.DB, serials []string) ([]models.SerialNumbers, error) {
+	sorted := append([]string{}, serials...)
+	sort.Strings(sorted)
+
+	serialNumbers := []models.SerialNumbers{}
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("serial IN ?", sorted).Order("serial").Find(&serialNumbers).Error; err != nil {
+		return nil, err
+	}
+
+	return serialNumbers, nil
+}
+
+// recordSerialMovement saves where SerialNumber is now, creating it when it's new, and writes its history
+func recordSerialMovement(c *gin.Context, tx *gorm.DB, SerialNumber models.SerialNumbers, SerialMovement models.SerialMovements) error {
+	if SerialNumber.ID == 0 {
+		if err := tx.Debug().Create(&SerialNumber).Error; err != nil {
+			return err
+		}
+	} else if err := tx.Debug().Model(&SerialNumber).Select("warehouse_id", "stock_lot_id", "status").Updates(SerialNumber).Error; err != nil {
+		return err
+	}
+
+	SerialMovement.SerialNumberID = SerialNumber.ID
+	SerialMovement.WarehouseID = SerialNumber.WarehouseID
+	SerialMovement.UserID = helpers.GetUserID(c)
+	SerialMovement.MovedAt = time.Now()
+
+	return tx.Debug().Create(&SerialMovement).Error
+}
+
+// receiveSerials puts the serials of productID in stock in the lot stockLotID, serials seen before may come back
+// once they were issued or their receipt was cancelled
+func receiveSerials(c *gin.Context, tx *gorm.DB, productID uint, stockLotID uint, SerialMovement models.SerialMovements, serials []string) error {
+	serialNumbers, err := lockSerials(tx, serials)
+
+	if err != nil {
+		return err
+	}
+
+	known := map[string]models.SerialNumbers{}
+	for _, SerialNumber := range serialNumbers {
+		known[SerialNumber.Serial] = SerialNumber
+	}
+
+	for _, serial := range serials {
+		SerialNumber, ok := known[serial]
+
+		if !ok {
+			SerialNumber = models.SerialNumbers{ProductID: productID, Serial: serial}
+		} else if SerialNumber.ProductID != productID {
+			return fmt.Errorf("Serial %s belongs to another product", serial)
+		} else if SerialNumber.Status == models.SerialStatusInStock {
+			return fmt.Errorf("Serial %s is already in stock", serial)
+		}
+
+		SerialNumber.WarehouseID = SerialMovement.WarehouseID
+		SerialNumber.StockLotID = stockLotID
+		SerialNumber.Status = models.SerialStatusInStock
+
+		if err := recordSerialMovement(c, tx, SerialNumber, SerialMovement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// issueSerials takes the serials of productID out of stock in SerialMovement.WarehouseID
+func issueSerials(c *gin.Context, tx *gorm.DB, productID uint, SerialMovement models.SerialMovements, serials []string) ([]models.SerialNumbers, error) {
+	serialNumbers, err := lockSerials(tx, serials)
+
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]models.SerialNumbers{}
+	for _, SerialNumber := range serialNumbers {
+		known[SerialNumber.Serial] = SerialNumber
+	}
+
+	issued := []models.SerialNumbers{}
+
+	for _, serial := range serials {
+		SerialNumber, ok := known[serial]
+
+		if !ok || SerialNumber.ProductID != productID {
+			return nil, fmt.Errorf("Serial %s Not Found", serial)
+		}
+
+		if SerialNumber.Status != models.SerialStatusInStock || SerialNumber.WarehouseID != SerialMovement.WarehouseID {
+			return nil, fmt.Errorf("Serial %s isn't in stock in this warehouse", serial)
+		}
+
+		SerialNumber.Status = models.SerialStatusIssued
+
+		if err := recordSerialMovement(c, tx, SerialNumber, SerialMovement); err != nil {
+			return nil, err
+		}
+
+		issued = append(issued, SerialNumber)
+	}
+
+	return issued, nil
+}
+
+// issueSerializedStock issues the serials and takes the stock out of the lots those serials were received into
+func issueSerializedStock(c *gin.Context, tx *gorm.DB, StockMovement models.StockMovements, serials []string) ([]models.StockMovements, error) {
+	serialNumbers, err := issueSerials(c, tx, StockMovement.ProductID, models.SerialMovements{
+		WarehouseID: StockMovement.WarehouseID,
+		SourceType:  StockMovement.SourceType,
+		SourceID:    StockMovement.SourceID,
+		Action:      models.MovementActionIssued,
+	}, serials)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lotQtys := map[uint]int64{}
+	stockLotIDs := []uint{}
+
+	for _, SerialNumber := range serialNumbers {
+		if _, ok := lotQtys[SerialNumber.StockLotID]; !ok {
+			stockLotIDs = append(stockLotIDs, SerialNumber.StockLotID)
+		}
+
+		lotQtys[SerialNumber.StockLotID]++
+	}
+
+	sort.Slice(stockLotIDs, func(i, j int) bool {
+		return stockLotIDs[i] < stockLotIDs[j]
+	})
+
+	stockMovements := []models.StockMovements{}
+
+	for _, stockLotID := range stockLotIDs {
+		StockLot := models.StockLots{}
+		if err := tx.Debug().Where("id = ?", stockLotID).First(&StockLot).Error; err != nil {
+			return nil, errors.New("Lot Not Found")
+		}
+
+		Recorded, err := issueStock(c, tx, StockMovement, decimal.NewFromInt(lotQtys[stockLotID]), []string{StockLot.LotNumber}, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stockMovements = append(stockMovements, Recorded...)
+	}
+
+	return stockMovements, nil
+}
+
+// returnSerials reverses what the source document of SerialMovement did to its serials, received serials become
+// void again and issued serials go back in stock
+func returnSerials(c *gin.Context, tx *gorm.DB, SerialMovement models.SerialMovements) error {
+	serialMovements := []models.SerialMovements{}
+	if err := tx.Debug().Where("source_type = ? AND source_id = ? AND action IN ?", SerialMovement.SourceType, SerialMovement.SourceID, []string{models.MovementActionReceived, models.MovementActionIssued}).Order("serial_number_id").Find(&serialMovements).Error; err != nil {
+		return err
+	}
+
+	for _, Moved := range serialMovements {
+		SerialNumber := models.SerialNumbers{}
+		if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", Moved.SerialNumberID).First(&SerialNumber).Error; err != nil {
+			return err
+		}
+
+		if Moved.Action == models.MovementActionReceived {
+			if SerialNumber.Status != models.SerialStatusInStock || SerialNumber.WarehouseID != Moved.WarehouseID {
+				return fmt.Errorf("Serial %s has already left the warehouse", SerialNumber.Serial)
+			}
+
+			SerialNumber.Status = models.SerialStatusVoid
+		} else {
+			if SerialNumber.Status != models.SerialStatusIssued {
+				return fmt.Errorf("Serial %s is back in stock already", SerialNumber.Serial)
+			}
+
+			SerialNumber.Status = models.SerialStatusInStock
+			SerialNumber.WarehouseID = Moved.WarehouseID
+		}
+
+		if err := recordSerialMovement(c, tx, SerialNumber, SerialMovement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetSerialNumber shows where a single serialized piece is and every document that moved it
+func GetSerialNumber(c *gin.Context) {
+	db := database.GetDB()
+
+	unscoped := func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}
+
+	SerialNumber := models.SerialNumbers{}
+	result := db.Debug().Preload("Products", unscoped).Preload("Warehouses", unscoped).Preload("StockLots").Preload("Movements", func(db *gorm.DB) *gorm.DB {
+		return db.Order("moved_at ASC, id ASC")
+	}).Preload("Movements.Users").Preload("Movements.Warehouses", unscoped).Where("serial = ?", c.Param("serial")).Find(&SerialNumber)
+
+	if result.Error != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": result.Error.Error(),
+		})
+
+		return
+	}
+
+	if result.RowsAffected < 1 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, SerialNumber)
+}
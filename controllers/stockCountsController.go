@@ -0,0 +1,781 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"inventoryapp/outbox"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func lockStockCount(tx *gorm.DB, stockCountId int) (models.StockCounts, error) {
+	StockCount := models.StockCounts{}
+	err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Lines").Where("id = ?", stockCountId).First(&StockCount).Error
+
+	return StockCount, err
+}
+
+func preloadStockCount(db *gorm.DB) *gorm.DB {
+	return db.Preload("Lines.Entries.Users").Preload("Lines.Products", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Warehouses", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Users")
+}
+
+// stockCountVariance compares the counted quantity of a line with the frozen system stock plus everything
+// that moved in the warehouse between the start of the count and the moment the line was counted
+func stockCountVariance(db *gorm.DB, StockCount models.StockCounts, Line models.StockCountLines) (helpers.StockCountVarianceResponse, error) {
+	Variance := helpers.StockCountVarianceResponse{
+		ProductID:   Line.ProductID,
+		FrozenQty:   Line.FrozenQty,
+		MovedQty:    decimal.Zero,
+		ExpectedQty: Line.FrozenQty,
+		CountedQty:  Line.CountedQty,
+		CountedAt:   Line.CountedAt,
+	}
+
+	if Line.CountedQty == nil || Line.CountedAt == nil {
+		return Variance, nil
+	}
+
+	err := db.Debug().Model(&models.StockMovements{}).
+		Select("COALESCE(SUM(qty), 0)").
+		Where("product_id = ? AND warehouse_id = ? AND moved_at > ? AND moved_at <= ? AND source_type <> ?", Line.ProductID, StockCount.WarehouseID, StockCount.StartedAt, *Line.CountedAt, models.MovementSourceStockCount).
+		Scan(&Variance.MovedQty).Error
+
+	if err != nil {
+		return Variance, err
+	}
+
+	varianceQty := Line.CountedQty.Sub(Variance.FrozenQty.Add(Variance.MovedQty))
+	Variance.ExpectedQty = Variance.FrozenQty.Add(Variance.MovedQty)
+	Variance.VarianceQty = &varianceQty
+
+	return Variance, nil
+}
+
+func GetStockCounts(c *gin.Context) {
+	db := database.GetDB()
+
+	stockCounts := []models.StockCounts{}
+	stockCountID := c.Param("stockCountId")
+
+	if stockCountID != "" {
+		id, err := strconv.Atoi(stockCountID)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		result := preloadStockCount(db.Debug()).Where("id = ?", id).Find(&stockCounts)
+		count := result.RowsAffected
+
+		if result.Error != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		if count < 1 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Data Not Found",
+				"message": "Data Doesn't Exist",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, stockCounts[0])
+		return
+	}
+
+	query := db.Debug().Preload("Warehouses", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Users")
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Find(&stockCounts).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, stockCounts)
+}
+
+func CreateStockCount(c *gin.Context) {
+	db := database.GetDB()
+
+	StockCountInput := helpers.StockCountInput{}
+
+	if err := c.ShouldBindJSON(&StockCountInput); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	if err := tx.Debug().Where("id = ?", StockCountInput.WarehouseID).First(&models.Warehouses{}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Warehouse Not Found",
+		})
+
+		return
+	}
+
+	productIDs := StockCountInput.ProductIDs
+
+	// without a product list the count covers everything the warehouse holds
+	if len(productIDs) == 0 {
+		if err := tx.Debug().Model(&models.ProductStocks{}).Where("warehouse_id = ? AND stock <> 0", StockCountInput.WarehouseID).Pluck("product_id", &productIDs).Error; err != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	var productCount int64
+	tx.Debug().Model(&models.Products{}).Where("id IN ?", productIDs).Count(&productCount)
+
+	if len(productIDs) == 0 || productCount != int64(len(productIDs)) {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Product Not Found",
+		})
+
+		return
+	}
+
+	// FOR SHARE waits for stock changes in flight, so the frozen stock and the start time agree with the ledger
+	productStocks := []models.ProductStocks{}
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "SHARE"}).Where("warehouse_id = ? AND product_id IN ?", StockCountInput.WarehouseID, productIDs).Order("product_id").Find(&productStocks).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	frozen := map[uint]decimal.Decimal{}
+	for _, ProductStock := range productStocks {
+		frozen[ProductStock.ProductID] = ProductStock.Stock
+	}
+
+	StockCount := models.StockCounts{
+		WarehouseID: StockCountInput.WarehouseID,
+		Status:      models.StockCountStatusOpen,
+		Note:        StockCountInput.Note,
+		UserID:      helpers.GetUserID(c),
+		StartedAt:   time.Now(),
+	}
+
+	for _, productID := range productIDs {
+		StockCount.Lines = append(StockCount.Lines, models.StockCountLines{
+			ProductID: productID,
+			FrozenQty: frozen[productID],
+		})
+	}
+
+	if err := tx.Debug().Create(&StockCount).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionCreate, models.AuditEntityStockCount, StockCount.ID, nil, &models.StockCounts{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := preloadStockCount(db.Debug()).First(&StockCount, StockCount.ID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, StockCount)
+}
+
+// CreateStockCountEntry records what the current user counted for one product of an open count,
+// several users may count the same product and the line sums their entries, entering again replaces the own entry
+func CreateStockCountEntry(c *gin.Context) {
+	db := database.GetDB()
+
+	stockCountId, err := strconv.Atoi(c.Param("stockCountId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	EntryInput := helpers.StockCountEntryInput{}
+
+	if err := c.ShouldBindJSON(&EntryInput); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if EntryInput.Qty.IsNegative() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Counted quantity can't be negative",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	StockCount, err := lockStockCount(tx, stockCountId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Stock Count Not Found",
+		})
+
+		return
+	}
+
+	if StockCount.Status != models.StockCountStatusOpen {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Stock count is " + StockCount.Status,
+		})
+
+		return
+	}
+
+	var Line *models.StockCountLines
+	for i := range StockCount.Lines {
+		if StockCount.Lines[i].ProductID == EntryInput.ProductID {
+			Line = &StockCount.Lines[i]
+		}
+	}
+
+	if Line == nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Product is not part of the stock count",
+		})
+
+		return
+	}
+
+	Product := models.Products{}
+	if err := tx.Debug().Where("id = ?", Line.ProductID).First(&Product).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Product Not Found",
+		})
+
+		return
+	}
+
+	Entry := models.StockCountEntries{
+		StockCountLineID: Line.ID,
+		UserID:           helpers.GetUserID(c),
+		Qty:              EntryInput.Qty,
+		Unit:             Product.Unit,
+		BaseQty:          decimal.Zero,
+		CountedAt:        time.Now(),
+	}
+
+	// an empty shelf is a valid count, anything else is normalized to the base unit
+	if !EntryInput.Qty.IsZero() {
+		Entry.BaseQty, Entry.Unit, err = toBaseQty(tx, Product, EntryInput.Qty, EntryInput.Unit)
+
+		if err != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	if err := tx.Debug().Where("stock_count_line_id = ? AND user_id = ?", Line.ID, Entry.UserID).Delete(&models.StockCountEntries{}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Create(&Entry).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	countedQty := decimal.Zero
+	if err := tx.Debug().Model(&models.StockCountEntries{}).Select("COALESCE(SUM(base_qty), 0)").Where("stock_count_line_id = ?", Line.ID).Scan(&countedQty).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Model(Line).Updates(map[string]interface{}{
+		"counted_qty": countedQty,
+		"counted_at":  Entry.CountedAt,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntityStockCountEntry, Entry.ID, nil, Entry); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := preloadStockCount(db.Debug()).First(&StockCount, StockCount.ID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, StockCount)
+}
+
+func GetStockCountVariances(c *gin.Context) {
+	db := database.GetDB()
+
+	stockCountId, err := strconv.Atoi(c.Param("stockCountId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	StockCount := models.StockCounts{}
+	if err := db.Debug().Preload("Lines").Where("id = ?", stockCountId).First(&StockCount).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	variances := []helpers.StockCountVarianceResponse{}
+	for _, Line := range StockCount.Lines {
+		Variance, err := stockCountVariance(db, StockCount, Line)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+
+		variances = append(variances, Variance)
+	}
+
+	c.JSON(http.StatusOK, variances)
+}
+
+// postStockCountLines turns the variance of every counted line into an adjustment movement,
+// lines nobody counted are left as they are
+func postStockCountLines(c *gin.Context, tx *gorm.DB, StockCount models.StockCounts, PostInput helpers.StockCountPostInput) error {
+	reasonCodes := map[uint]string{}
+	for _, LineReason := range PostInput.Lines {
+		reasonCodes[LineReason.ProductID] = LineReason.ReasonCode
+	}
+
+	lines := append([]models.StockCountLines{}, StockCount.Lines...)
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].ProductID < lines[j].ProductID
+	})
+
+	for _, Line := range lines {
+		Variance, err := stockCountVariance(tx, StockCount, Line)
+
+		if err != nil {
+			return err
+		}
+
+		if Variance.VarianceQty == nil {
+			continue
+		}
+
+		reasonCode := reasonCodes[Line.ProductID]
+
+		if reasonCode == "" {
+			reasonCode = PostInput.ReasonCode
+		}
+
+		if reasonCode == "" {
+			reasonCode = models.ReasonCountVariance
+		}
+
+		if !models.IsReasonCode(reasonCode) {
+			return errors.New("Unknown reason code " + reasonCode)
+		}
+
+		if err := tx.Debug().Model(&Line).Updates(map[string]interface{}{
+			"variance_qty": *Variance.VarianceQty,
+			"reason_code":  reasonCode,
+		}).Error; err != nil {
+			return err
+		}
+
+		if Variance.VarianceQty.IsZero() {
+			continue
+		}
+
+		Product, err := lockProduct(tx, Line.ProductID)
+
+		if err != nil {
+			return err
+		}
+
+		// a count doesn't say which serials are missing or found
+		if Product.Serialized {
+			return fmt.Errorf("Variance of serialized product %d must be settled through incoming or outgoing items", Product.ID)
+		}
+
+		Movement := models.StockMovements{
+			ProductID:   Line.ProductID,
+			WarehouseID: StockCount.WarehouseID,
+			SourceType:  models.MovementSourceStockCount,
+			SourceID:    StockCount.ID,
+			Action:      models.MovementActionAdjusted,
+			ReasonCode:  reasonCode,
+		}
+
+		// surplus lands in the lot without a number, shortage is taken first-expiry-first-out
+		if Variance.VarianceQty.IsPositive() {
+			_, err = receiveStock(c, tx, Movement, *Variance.VarianceQty, "", nil)
+		} else {
+			_, err = issueStock(c, tx, Movement, Variance.VarianceQty.Neg(), nil, false)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// a count can't be refused for what it found missing, but sales orders reserving more than is left
+		// are announced so somebody sorts them out
+		if Variance.VarianceQty.IsNegative() {
+			available, err := availableStock(tx, Product.ID, StockCount.WarehouseID)
+
+			if err != nil {
+				return err
+			}
+
+			if available.IsNegative() {
+				if err := outbox.Record(tx, models.EventProductOverReserved, Product.ID, helpers.OverReservedResponse{
+					ProductID:   Product.ID,
+					WarehouseID: StockCount.WarehouseID,
+					Shortfall:   available.Neg(),
+					SourceType:  models.MovementSourceStockCount,
+					SourceID:    StockCount.ID,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func PostStockCount(c *gin.Context) {
+	db := database.GetDB()
+
+	stockCountId, err := strconv.Atoi(c.Param("stockCountId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	PostInput := helpers.StockCountPostInput{}
+
+	// the body is optional, without it every variance gets the default reason code
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&PostInput); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	tx := db.Begin()
+
+	StockCount, err := lockStockCount(tx, stockCountId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Stock Count Not Found",
+		})
+
+		return
+	}
+
+	if StockCount.Status != models.StockCountStatusOpen {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Stock count is " + StockCount.Status,
+		})
+
+		return
+	}
+
+	before := StockCount
+
+	if err := postStockCountLines(c, tx, StockCount, PostInput); err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
+
+		return
+	}
+
+	if err := tx.Debug().Model(&StockCount).Updates(map[string]interface{}{
+		"status":    models.StockCountStatusPosted,
+		"posted_at": time.Now(),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionPost, models.AuditEntityStockCount, StockCount.ID, before, &models.StockCounts{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := preloadStockCount(db.Debug()).First(&StockCount, StockCount.ID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, StockCount)
+}
+
+func CancelStockCount(c *gin.Context) {
+	db := database.GetDB()
+
+	stockCountId, err := strconv.Atoi(c.Param("stockCountId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	StockCount, err := lockStockCount(tx, stockCountId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Stock Count Not Found",
+		})
+
+		return
+	}
+
+	if StockCount.Status != models.StockCountStatusOpen {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Stock count is " + StockCount.Status,
+		})
+
+		return
+	}
+
+	before := StockCount
+
+	if err := tx.Debug().Model(&StockCount).Updates(map[string]interface{}{
+		"status":       models.StockCountStatusCancelled,
+		"cancelled_at": time.Now(),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionCancel, models.AuditEntityStockCount, StockCount.ID, before, &models.StockCounts{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := preloadStockCount(db.Debug()).First(&StockCount, StockCount.ID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, StockCount)
+}
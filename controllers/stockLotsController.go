@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"inventoryapp/database"
+	"inventoryapp/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func preloadStockLot(db *gorm.DB) *gorm.DB {
+	unscoped := func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}
+
+	return db.Preload("Products", unscoped).Preload("Warehouses", unscoped)
+}
+
+func GetStockLots(c *gin.Context) {
+	db := database.GetDB()
+
+	stockLots := []models.StockLots{}
+	query := preloadStockLot(db.Debug()).Order("product_id, warehouse_id, expiry_date ASC NULLS LAST")
+
+	if productId := c.Query("product_id"); productId != "" {
+		query = query.Where("product_id = ?", productId)
+	}
+
+	if warehouseId := c.Query("warehouse_id"); warehouseId != "" {
+		query = query.Where("warehouse_id = ?", warehouseId)
+	}
+
+	if err := query.Find(&stockLots).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, stockLots)
+}
+
+// GetExpiringStockLots lists the lots still in stock that expire within the next days, expired ones included
+func GetExpiringStockLots(c *gin.Context) {
+	db := database.GetDB()
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+
+	if err != nil || days < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	stockLots := []models.StockLots{}
+	query := preloadStockLot(db.Debug()).
+		Where("stock > 0 AND expiry_date IS NOT NULL AND expiry_date <= CURRENT_DATE + ?::int", days).
+		Order("expiry_date ASC, id ASC")
+
+	if warehouseId := c.Query("warehouse_id"); warehouseId != "" {
+		query = query.Where("warehouse_id = ?", warehouseId)
+	}
+
+	if err := query.Find(&stockLots).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, stockLots)
+}
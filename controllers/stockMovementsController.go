@@ -0,0 +1,474 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"inventoryapp/notifier"
+	"inventoryapp/outbox"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InsufficientStockError is returned when a movement would take the stock of a product below zero
+// and the product doesn't allow backorders
+type InsufficientStockError struct {
+	ProductID   uint
+	WarehouseID uint
+	LotNumber   string
+	Requested   decimal.Decimal
+	Available   decimal.Decimal
+}
+
+func (e *InsufficientStockError) Error() string {
+	if e.LotNumber != "" {
+		return fmt.Sprintf("Insufficient stock for product %d in lot %s of warehouse %d, requested %s but only %s available", e.ProductID, e.LotNumber, e.WarehouseID, e.Requested, e.Available)
+	}
+
+	return fmt.Sprintf("Insufficient stock for product %d in warehouse %d, requested %s but only %s available", e.ProductID, e.WarehouseID, e.Requested, e.Available)
+}
+
+// abortWithStockError answers 409 Conflict with requested and available quantity when the stock is insufficient,
+// any other error is a plain 400 Bad Request
+func abortWithStockError(c *gin.Context, err error) {
+	var stockErr *InsufficientStockError
+
+	if errors.As(err, &stockErr) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error":        "Conflict",
+			"message":      stockErr.Error(),
+			"product_id":   stockErr.ProductID,
+			"warehouse_id": stockErr.WarehouseID,
+			"lot_number":   stockErr.LotNumber,
+			"requested":    stockErr.Requested,
+			"available":    stockErr.Available,
+		})
+
+		return
+	}
+
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+		"error":   "Bad Request",
+		"message": err.Error(),
+	})
+}
+
+// lockProduct reads the product with SELECT ... FOR UPDATE, so concurrent stock changes on the same product are serialized
+// until the surrounding transaction commits or rolls back
+func lockProduct(tx *gorm.DB, productID uint) (models.Products, error) {
+	Product := models.Products{}
+	err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", productID).First(&Product).Error
+
+	return Product, err
+}
+
+// toBaseQty converts qty given in unit to the product's base unit, an empty unit means the base unit itself.
+// It returns the normalized quantity together with the resolved unit name
+func toBaseQty(tx *gorm.DB, Product models.Products, qty decimal.Decimal, unit string) (decimal.Decimal, string, error) {
+	if !qty.IsPositive() {
+		return decimal.Zero, "", errors.New("Quantity must be greater than zero")
+	}
+
+	baseQty := qty
+
+	if unit == "" {
+		unit = Product.Unit
+	}
+
+	if unit != Product.Unit {
+		UnitConversion := models.UnitConversions{}
+		if err := tx.Debug().Where("product_id = ? AND unit = ?", Product.ID, unit).First(&UnitConversion).Error; err != nil {
+			return decimal.Zero, "", fmt.Errorf("Unit %s is not defined for product %s", unit, Product.Name)
+		}
+
+		baseQty = qty.Mul(UnitConversion.Factor)
+	}
+
+	if !Product.IsWholeQty(baseQty) {
+		return decimal.Zero, "", fmt.Errorf("Quantity of product %s must be a whole number of %s", Product.Name, Product.Unit)
+	}
+
+	return baseQty, unit, nil
+}
+
+// lockProductStock reads the balance of a product in a warehouse with SELECT ... FOR UPDATE,
+// a missing balance row is created empty as long as the warehouse exists
+func lockProductStock(tx *gorm.DB, productID uint, warehouseID uint) (models.ProductStocks, error) {
+	ProductStock := models.ProductStocks{}
+	err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ? AND warehouse_id = ?", productID, warehouseID).First(&ProductStock).Error
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return ProductStock, err
+	}
+
+	if err := tx.Debug().Where("id = ?", warehouseID).First(&models.Warehouses{}).Error; err != nil {
+		return ProductStock, errors.New("Warehouse Not Found")
+	}
+
+	ProductStock = models.ProductStocks{
+		ProductID:   productID,
+		WarehouseID: warehouseID,
+		Stock:       decimal.Zero,
+	}
+	err = tx.Debug().Create(&ProductStock).Error
+
+	return ProductStock, err
+}
+
+// lockStockLot reads a lot of a product in a warehouse with SELECT ... FOR UPDATE, a missing lot is created empty.
+// Callers must hold the product lock, so two requests never create the same lot
+func lockStockLot(tx *gorm.DB, productID uint, warehouseID uint, lotNumber string, expiryDate *models.CustomTime) (models.StockLots, error) {
+	StockLot := models.StockLots{}
+	err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ? AND warehouse_id = ? AND lot_number = ?", productID, warehouseID, lotNumber).First(&StockLot).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		StockLot = models.StockLots{
+			ProductID:   productID,
+			WarehouseID: warehouseID,
+			LotNumber:   lotNumber,
+			ExpiryDate:  expiryDate,
+			Stock:       decimal.Zero,
+		}
+
+		return StockLot, tx.Debug().Create(&StockLot).Error
+	}
+
+	if err != nil {
+		return StockLot, err
+	}
+
+	if expiryDate == nil {
+		return StockLot, nil
+	}
+
+	if StockLot.ExpiryDate == nil {
+		StockLot.ExpiryDate = expiryDate
+
+		return StockLot, tx.Debug().Model(&StockLot).Update("expiry_date", expiryDate).Error
+	}
+
+	if !StockLot.ExpiryDate.Time.Equal(expiryDate.Time) {
+		return StockLot, fmt.Errorf("Lot %s already expires on %s", lotNumber, StockLot.ExpiryDate.Format("2006-01-02"))
+	}
+
+	return StockLot, nil
+}
+
+// recordStockMovement applies StockMovement.Qty, in the product's base unit, to the lot StockMovement.StockLotID,
+// to the balance of the product in StockMovement.WarehouseID and to the product total, then writes the movement to the ledger.
+// Products.Stock, ProductStocks.Stock and StockLots.Stock are only cached projections of the ledger,
+// so every stock change must go through here, usually by way of receiveStock, issueStock or returnStock.
+// tx must be a transaction, the product row stays locked until it ends
+func recordStockMovement(c *gin.Context, tx *gorm.DB, StockMovement models.StockMovements) (*models.StockMovements, error) {
+	Product, err := lockProduct(tx, StockMovement.ProductID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ProductStock, err := lockProductStock(tx, StockMovement.ProductID, StockMovement.WarehouseID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	StockLot := models.StockLots{}
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND product_id = ? AND warehouse_id = ?", StockMovement.StockLotID, StockMovement.ProductID, StockMovement.WarehouseID).First(&StockLot).Error; err != nil {
+		return nil, errors.New("Lot Not Found")
+	}
+
+	qty := StockMovement.Qty
+	newStock := ProductStock.Stock.Add(qty)
+
+	if qty.IsNegative() && newStock.IsNegative() && !Product.AllowBackorder {
+		return nil, &InsufficientStockError{
+			ProductID:   Product.ID,
+			WarehouseID: ProductStock.WarehouseID,
+			Requested:   qty.Neg(),
+			Available:   ProductStock.Stock,
+		}
+	}
+
+	// only the lot without a number can go negative, backordered stock has no lot yet
+	newLotStock := StockLot.Stock.Add(qty)
+
+	if qty.IsNegative() && newLotStock.IsNegative() && !(Product.AllowBackorder && StockLot.LotNumber == "") {
+		return nil, &InsufficientStockError{
+			ProductID:   Product.ID,
+			WarehouseID: ProductStock.WarehouseID,
+			LotNumber:   StockLot.LotNumber,
+			Requested:   qty.Neg(),
+			Available:   StockLot.Stock,
+		}
+	}
+
+	StockLot.Stock = newLotStock
+
+	if err := tx.Debug().Model(&StockLot).Update("stock", StockLot.Stock).Error; err != nil {
+		return nil, err
+	}
+
+	ProductStock.Stock = newStock
+
+	if err := tx.Debug().Save(&ProductStock).Error; err != nil {
+		return nil, err
+	}
+
+	previousStock := Product.Stock
+	Product.Stock = Product.Stock.Add(qty)
+
+	if err := tx.Debug().Save(&Product).Error; err != nil {
+		return nil, err
+	}
+
+	// only crossing the reorder point alerts, stock that stays below it was reported already
+	if Product.IsBelowReorderPoint(Product.Stock) && !Product.IsBelowReorderPoint(previousStock) {
+		if err := outbox.Record(tx, models.EventProductLowStock, Product.ID, notifier.Alert{
+			Type:         notifier.AlertTypeLowStock,
+			Subject:      fmt.Sprintf("%s is below its reorder point", Product.Name),
+			ProductID:    Product.ID,
+			ProductName:  Product.Name,
+			WarehouseID:  StockMovement.WarehouseID,
+			Stock:        Product.Stock,
+			ReorderPoint: Product.ReorderPoint,
+			SafetyStock:  Product.SafetyStock,
+			ReorderQty:   Product.ReorderQty,
+			RaisedAt:     time.Now(),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	StockMovement.BalanceAfter = Product.Stock
+	StockMovement.WarehouseBalanceAfter = ProductStock.Stock
+	StockMovement.UserID = helpers.GetUserID(c)
+	StockMovement.MovedAt = time.Now()
+
+	if err := tx.Debug().Create(&StockMovement).Error; err != nil {
+		return nil, err
+	}
+
+	if err := outbox.Record(tx, models.EventProductStockChanged, StockMovement.ProductID, StockMovement); err != nil {
+		return nil, err
+	}
+
+	return &StockMovement, nil
+}
+
+// receiveStock puts qty into the lot lotNumber of the product in StockMovement.WarehouseID, StockMovement carries
+// the product, warehouse and source document of the movement
+func receiveStock(c *gin.Context, tx *gorm.DB, StockMovement models.StockMovements, qty decimal.Decimal, lotNumber string, expiryDate *models.CustomTime) (*models.StockMovements, error) {
+	if _, err := lockProduct(tx, StockMovement.ProductID); err != nil {
+		return nil, err
+	}
+
+	if _, err := lockProductStock(tx, StockMovement.ProductID, StockMovement.WarehouseID); err != nil {
+		return nil, err
+	}
+
+	StockLot, err := lockStockLot(tx, StockMovement.ProductID, StockMovement.WarehouseID, lotNumber, expiryDate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	StockMovement.StockLotID = StockLot.ID
+	StockMovement.Qty = qty
+
+	return recordStockMovement(c, tx, StockMovement)
+}
+
+// issueStock takes qty out of StockMovement.WarehouseID, from the lots named in lotNumbers in that order or,
+// without names, first-expiry-first-out. skipExpired leaves expired lots alone when lots are picked automatically.
+// Every lot drawn from gets its own movement
+func issueStock(c *gin.Context, tx *gorm.DB, StockMovement models.StockMovements, qty decimal.Decimal, lotNumbers []string, skipExpired bool) ([]models.StockMovements, error) {
+	Product, err := lockProduct(tx, StockMovement.ProductID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := lockProductStock(tx, StockMovement.ProductID, StockMovement.WarehouseID); err != nil {
+		return nil, err
+	}
+
+	stockLots := []models.StockLots{}
+
+	if len(lotNumbers) > 0 {
+		for _, lotNumber := range lotNumbers {
+			StockLot := models.StockLots{}
+			if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ? AND warehouse_id = ? AND lot_number = ?", StockMovement.ProductID, StockMovement.WarehouseID, lotNumber).First(&StockLot).Error; err != nil {
+				return nil, fmt.Errorf("Lot %s Not Found", lotNumber)
+			}
+
+			stockLots = append(stockLots, StockLot)
+		}
+	} else {
+		query := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ? AND warehouse_id = ? AND stock > 0", StockMovement.ProductID, StockMovement.WarehouseID)
+
+		if skipExpired {
+			query = query.Where("expiry_date IS NULL OR expiry_date >= CURRENT_DATE")
+		}
+
+		if err := query.Order("expiry_date ASC NULLS LAST, id ASC").Find(&stockLots).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	stockMovements := []models.StockMovements{}
+	remaining := qty
+
+	for _, StockLot := range stockLots {
+		if !remaining.IsPositive() {
+			break
+		}
+
+		if !StockLot.Stock.IsPositive() {
+			continue
+		}
+
+		take := decimal.Min(StockLot.Stock, remaining)
+
+		LotMovement := StockMovement
+		LotMovement.StockLotID = StockLot.ID
+		LotMovement.Qty = take.Neg()
+
+		Recorded, err := recordStockMovement(c, tx, LotMovement)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stockMovements = append(stockMovements, *Recorded)
+		remaining = remaining.Sub(take)
+	}
+
+	if !remaining.IsPositive() {
+		return stockMovements, nil
+	}
+
+	if !Product.AllowBackorder || len(lotNumbers) > 0 {
+		return nil, &InsufficientStockError{
+			ProductID:   Product.ID,
+			WarehouseID: StockMovement.WarehouseID,
+			Requested:   qty,
+			Available:   qty.Sub(remaining),
+		}
+	}
+
+	// what the lots can't cover is backordered on the lot without a number
+	Recorded, err := receiveStock(c, tx, StockMovement, remaining.Neg(), "", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(stockMovements, *Recorded), nil
+}
+
+// returnStock reverses what the source document of StockMovement did to the product in StockMovement.WarehouseID,
+// lot by lot. A limit only reverses that much, starting with the lot that expires last
+func returnStock(c *gin.Context, tx *gorm.DB, StockMovement models.StockMovements, limit *decimal.Decimal) ([]models.StockMovements, error) {
+	if _, err := lockProduct(tx, StockMovement.ProductID); err != nil {
+		return nil, err
+	}
+
+	lotQtys := []struct {
+		StockLotID uint
+		Qty        decimal.Decimal
+	}{}
+
+	if err := tx.Debug().Model(&models.StockMovements{}).
+		Select("stock_movements.stock_lot_id, SUM(stock_movements.qty) AS qty").
+		Joins("JOIN stock_lots ON stock_lots.id = stock_movements.stock_lot_id").
+		Where("stock_movements.source_type = ? AND stock_movements.source_id = ? AND stock_movements.product_id = ? AND stock_movements.warehouse_id = ?", StockMovement.SourceType, StockMovement.SourceID, StockMovement.ProductID, StockMovement.WarehouseID).
+		Group("stock_movements.stock_lot_id, stock_lots.expiry_date").
+		Having("SUM(stock_movements.qty) <> 0").
+		Order("stock_lots.expiry_date DESC NULLS FIRST, stock_movements.stock_lot_id DESC").
+		Scan(&lotQtys).Error; err != nil {
+		return nil, err
+	}
+
+	stockMovements := []models.StockMovements{}
+
+	for _, LotQty := range lotQtys {
+		qty := LotQty.Qty.Neg()
+
+		if limit != nil {
+			if !limit.IsPositive() {
+				break
+			}
+
+			if qty.Abs().GreaterThan(*limit) {
+				qty = limit.Mul(decimal.NewFromInt(int64(qty.Sign())))
+			}
+
+			remaining := limit.Sub(qty.Abs())
+			limit = &remaining
+		}
+
+		LotMovement := StockMovement
+		LotMovement.StockLotID = LotQty.StockLotID
+		LotMovement.Qty = qty
+
+		Recorded, err := recordStockMovement(c, tx, LotMovement)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stockMovements = append(stockMovements, *Recorded)
+	}
+
+	return stockMovements, nil
+}
+
+func GetProductMovements(c *gin.Context) {
+	db := database.GetDB()
+
+	productId, err := strconv.Atoi(c.Param("productId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	Product := models.Products{}
+	if err := db.Debug().Unscoped().Where("id = ?", productId).First(&Product).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Product Not Found",
+		})
+
+		return
+	}
+
+	stockMovements := []models.StockMovements{}
+	if err := db.Debug().Where("product_id = ?", productId).Order("id asc").Preload("Users").Preload("StockLots").Preload("Warehouses", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Find(&stockMovements).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product":   Product.Response(),
+		"movements": stockMovements,
+	})
+}
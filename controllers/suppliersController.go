@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetSuppliers(c *gin.Context) {
+	db := database.GetDB()
+	suppliers := []models.Suppliers{}
+	supplierId := c.Param("supplierId")
+
+	if supplierId != "" {
+		id, err := strconv.Atoi(supplierId)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		result := db.Where("id = ?", id).Find(&suppliers)
+		count := result.RowsAffected
+		if result.Error != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		if count < 1 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Data Not Found",
+				"message": "Data Doesn't Exist",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, suppliers[0])
+		return
+	}
+
+	query := db.Debug()
+
+	if name := c.Query("name"); name != "" {
+		query = query.Where("name ILIKE ?", "%"+name+"%")
+	}
+
+	if err := query.Find(&suppliers).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, suppliers)
+}
+
+func CreateSupplier(c *gin.Context) {
+	db := database.GetDB()
+	contentType := helpers.GetContentType(c)
+
+	Supplier := models.Suppliers{}
+
+	if contentType == appJSON {
+		c.ShouldBindJSON(&Supplier)
+	} else {
+		c.ShouldBind(&Supplier)
+	}
+
+	tx := db.Begin()
+
+	if err := tx.Debug().Create(&Supplier).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntitySupplier, Supplier.ID, nil, Supplier); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Supplier)
+}
+
+func UpdateSupplier(c *gin.Context) {
+	db := database.GetDB()
+	contentType := helpers.GetContentType(c)
+
+	Supplier := models.Suppliers{}
+
+	supplierId, _ := strconv.Atoi(c.Param("supplierId"))
+
+	if contentType == appJSON {
+		c.ShouldBindJSON(&Supplier)
+	} else {
+		c.ShouldBind(&Supplier)
+	}
+
+	Supplier.ID = uint(supplierId)
+
+	tx := db.Begin()
+
+	previousSupplier := models.Suppliers{}
+	if err := tx.Debug().Where("id = ?", supplierId).First(&previousSupplier).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	err := tx.Model(&Supplier).Where("id = ?", supplierId).Updates(models.Suppliers{
+		Code:        Supplier.Code,
+		Name:        Supplier.Name,
+		ContactName: Supplier.ContactName,
+		Email:       Supplier.Email,
+		Phone:       Supplier.Phone,
+		Address:     Supplier.Address,
+	}).Error
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	UpdatedSupplier := models.Suppliers{}
+	if err := tx.Debug().First(&UpdatedSupplier, supplierId).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionUpdate, models.AuditEntitySupplier, UpdatedSupplier.ID, previousSupplier, UpdatedSupplier); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Supplier)
+}
+
+func DeleteSupplier(c *gin.Context) {
+	db := database.GetDB()
+	supplierId, err := strconv.Atoi(c.Param("supplierId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	Supplier := models.Suppliers{}
+	if err := db.Debug().Where("id = ?", supplierId).First(&Supplier).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	// incoming items keep pointing at their supplier, so suppliers are only archived
+	if err := tx.Delete(&Supplier).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionArchive, models.AuditEntitySupplier, Supplier.ID, Supplier, nil); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Successfully archived supplier",
+		"supplier": Supplier,
+	})
+}
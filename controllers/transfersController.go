@@ -0,0 +1,602 @@
+package controllers
+
+import (
+	"errors"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// prepareTransferLines checks both warehouses and normalizes every line to the base unit of its product
+func prepareTransferLines(tx *gorm.DB, Transfer *models.Transfers) error {
+	if len(Transfer.Lines) == 0 {
+		return errors.New("Transfer needs at least one line")
+	}
+
+	for _, warehouseID := range []uint{Transfer.SourceWarehouseID, Transfer.DestinationWarehouseID} {
+		if err := tx.Debug().Where("id = ?", warehouseID).First(&models.Warehouses{}).Error; err != nil {
+			return errors.New("Warehouse Not Found")
+		}
+	}
+
+	for i := range Transfer.Lines {
+		Line := &Transfer.Lines[i]
+
+		Product := models.Products{}
+		if err := tx.Debug().Where("id = ?", Line.ProductID).First(&Product).Error; err != nil {
+			return errors.New("Product Not Found")
+		}
+
+		// transfer lines don't name serials, serialized pieces move through outgoing and incoming items
+		if Product.Serialized {
+			return errors.New("Serialized products can't be transferred")
+		}
+
+		baseQty, unit, err := toBaseQty(tx, Product, Line.Qty, Line.Unit)
+
+		if err != nil {
+			return err
+		}
+
+		Line.ID = 0
+		Line.TransferID = Transfer.ID
+		Line.BaseQty, Line.Unit = baseQty, unit
+	}
+
+	return nil
+}
+
+// transferProductIDs lists every product on the transfer once, in product order so two transfers
+// never lock the same products the other way round
+func transferProductIDs(Transfer models.Transfers) []uint {
+	productIDs := []uint{}
+	seen := map[uint]bool{}
+
+	for _, Line := range Transfer.Lines {
+		if !seen[Line.ProductID] {
+			seen[Line.ProductID] = true
+			productIDs = append(productIDs, Line.ProductID)
+		}
+	}
+
+	sort.Slice(productIDs, func(i, j int) bool {
+		return productIDs[i] < productIDs[j]
+	})
+
+	return productIDs
+}
+
+// dispatchTransferLines takes every line out of the source warehouse first-expiry-first-out.
+// Lines are handled in product order so two transfers never lock the same products the other way round
+func dispatchTransferLines(c *gin.Context, tx *gorm.DB, Transfer models.Transfers) error {
+	lines := append([]models.TransferLines{}, Transfer.Lines...)
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].ProductID < lines[j].ProductID
+	})
+
+	for _, Line := range lines {
+		Product, err := lockProduct(tx, Line.ProductID)
+
+		if err != nil {
+			return errors.New("Product Not Found")
+		}
+
+		// stock reserved by sales orders stays in the source warehouse, and only stock on hand can leave it
+		// even when the product allows backorders
+		if err := checkOnHand(tx, Product, Transfer.SourceWarehouseID, Line.BaseQty); err != nil {
+			return err
+		}
+
+		if _, err := issueStock(c, tx, models.StockMovements{
+			ProductID:   Line.ProductID,
+			WarehouseID: Transfer.SourceWarehouseID,
+			SourceType:  models.MovementSourceTransfer,
+			SourceID:    Transfer.ID,
+			Action:      models.MovementActionDispatched,
+		}, Line.BaseQty, nil, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// receiveTransferLines books in the destination warehouse exactly the lots that left the source warehouse
+func receiveTransferLines(c *gin.Context, tx *gorm.DB, Transfer models.Transfers) error {
+	for _, productID := range transferProductIDs(Transfer) {
+		dispatchedLots := []struct {
+			LotNumber  string
+			ExpiryDate *models.CustomTime
+			Qty        decimal.Decimal
+		}{}
+
+		if err := tx.Debug().Model(&models.StockMovements{}).
+			Select("stock_lots.lot_number, stock_lots.expiry_date, SUM(stock_movements.qty) AS qty").
+			Joins("JOIN stock_lots ON stock_lots.id = stock_movements.stock_lot_id").
+			Where("stock_movements.source_type = ? AND stock_movements.source_id = ? AND stock_movements.product_id = ? AND stock_movements.warehouse_id = ?", models.MovementSourceTransfer, Transfer.ID, productID, Transfer.SourceWarehouseID).
+			Group("stock_lots.lot_number, stock_lots.expiry_date").
+			Having("SUM(stock_movements.qty) <> 0").
+			Order("stock_lots.lot_number").
+			Scan(&dispatchedLots).Error; err != nil {
+			return err
+		}
+
+		for _, DispatchedLot := range dispatchedLots {
+			if _, err := receiveStock(c, tx, models.StockMovements{
+				ProductID:   productID,
+				WarehouseID: Transfer.DestinationWarehouseID,
+				SourceType:  models.MovementSourceTransfer,
+				SourceID:    Transfer.ID,
+				Action:      models.MovementActionReceived,
+			}, DispatchedLot.Qty.Neg(), DispatchedLot.LotNumber, DispatchedLot.ExpiryDate); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// returnTransferLines puts the dispatched lots back into the source warehouse
+func returnTransferLines(c *gin.Context, tx *gorm.DB, Transfer models.Transfers) error {
+	for _, productID := range transferProductIDs(Transfer) {
+		if _, err := returnStock(c, tx, models.StockMovements{
+			ProductID:   productID,
+			WarehouseID: Transfer.SourceWarehouseID,
+			SourceType:  models.MovementSourceTransfer,
+			SourceID:    Transfer.ID,
+			Action:      models.MovementActionCancelled,
+		}, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func lockTransfer(tx *gorm.DB, transferId int) (models.Transfers, error) {
+	Transfer := models.Transfers{}
+	err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Lines").Where("id = ?", transferId).First(&Transfer).Error
+
+	return Transfer, err
+}
+
+func preloadTransfer(db *gorm.DB) *gorm.DB {
+	unscoped := func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}
+
+	return db.Preload("Lines.Products", unscoped).Preload("SourceWarehouses", unscoped).Preload("DestinationWarehouses", unscoped).Preload("Users")
+}
+
+func GetTransfers(c *gin.Context) {
+	db := database.GetDB()
+
+	transfers := []models.Transfers{}
+	transferID := c.Param("transferId")
+
+	if transferID != "" {
+		id, err := strconv.Atoi(transferID)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		result := preloadTransfer(db.Debug()).Where("id = ?", id).Find(&transfers)
+		count := result.RowsAffected
+
+		if result.Error != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		if count < 1 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Data Not Found",
+				"message": "Data Doesn't Exist",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, transfers[0])
+		return
+	}
+
+	query := preloadTransfer(db.Debug())
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Find(&transfers).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, transfers)
+}
+
+func CreateTransfer(c *gin.Context) {
+	db := database.GetDB()
+
+	Transfer := models.Transfers{}
+
+	if err := c.ShouldBindJSON(&Transfer); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	// every transfer starts as a draft, stock only moves on dispatch
+	Transfer.Status = models.TransferStatusDraft
+	Transfer.UserID = helpers.GetUserID(c)
+
+	tx := db.Begin()
+
+	if err := prepareTransferLines(tx, &Transfer); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Create(&Transfer).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionCreate, models.AuditEntityTransfer, Transfer.ID, nil, &models.Transfers{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := preloadTransfer(db.Debug()).First(&Transfer, Transfer.ID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Transfer)
+}
+
+func UpdateTransfer(c *gin.Context) {
+	db := database.GetDB()
+
+	Transfer := models.Transfers{}
+	transferId, err := strconv.Atoi(c.Param("transferId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	if err := c.ShouldBindJSON(&Transfer); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	previousTransfer, err := lockTransfer(tx, transferId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Transfer Not Found",
+		})
+
+		return
+	}
+
+	if previousTransfer.Status != models.TransferStatusDraft {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Only draft transfers can be changed",
+		})
+
+		return
+	}
+
+	Transfer.ID = previousTransfer.ID
+
+	if err := prepareTransferLines(tx, &Transfer); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	previousTransfer.SourceWarehouseID = Transfer.SourceWarehouseID
+	previousTransfer.DestinationWarehouseID = Transfer.DestinationWarehouseID
+
+	before := previousTransfer
+
+	if err := tx.Debug().Model(&previousTransfer).Updates(map[string]interface{}{
+		"source_warehouse_id":      Transfer.SourceWarehouseID,
+		"destination_warehouse_id": Transfer.DestinationWarehouseID,
+		"note":                     Transfer.Note,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	// a draft has no stock effect yet, so its lines are simply replaced
+	if err := tx.Debug().Where("transfer_id = ?", previousTransfer.ID).Delete(&models.TransferLines{}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Create(&Transfer.Lines).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, models.AuditActionUpdate, models.AuditEntityTransfer, previousTransfer.ID, before, &models.Transfers{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := preloadTransfer(db.Debug()).First(&Transfer, Transfer.ID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Transfer)
+}
+
+// changeTransferStatus moves a transfer from one of the allowed statuses to the next one,
+// book does the stock side of the step inside the same transaction
+func changeTransferStatus(c *gin.Context, allowed []string, next string, book func(tx *gorm.DB, Transfer models.Transfers) error) {
+	db := database.GetDB()
+
+	transferId, err := strconv.Atoi(c.Param("transferId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	Transfer, err := lockTransfer(tx, transferId)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Transfer Not Found",
+		})
+
+		return
+	}
+
+	isAllowed := false
+	for _, status := range allowed {
+		isAllowed = isAllowed || Transfer.Status == status
+	}
+
+	if !isAllowed {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Transfer is " + Transfer.Status + " and can't become " + next,
+		})
+
+		return
+	}
+
+	if err := book(tx, Transfer); err != nil {
+		tx.Rollback()
+		abortWithStockError(c, err)
+
+		return
+	}
+
+	now := time.Now()
+	before := Transfer
+	changes := map[string]interface{}{"status": next}
+	action := ""
+
+	switch next {
+	case models.TransferStatusInTransit:
+		changes["dispatched_at"] = now
+		action = models.AuditActionDispatch
+	case models.TransferStatusReceived:
+		changes["received_at"] = now
+		action = models.AuditActionReceive
+	case models.TransferStatusCancelled:
+		changes["cancelled_at"] = now
+		action = models.AuditActionCancel
+	}
+
+	if err := tx.Debug().Model(&Transfer).Updates(changes).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordDocumentAudit(c, tx, action, models.AuditEntityTransfer, Transfer.ID, before, &models.Transfers{}); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := preloadTransfer(db.Debug()).First(&Transfer, Transfer.ID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Transfer)
+}
+
+func DispatchTransfer(c *gin.Context) {
+	changeTransferStatus(c, []string{models.TransferStatusDraft}, models.TransferStatusInTransit, func(tx *gorm.DB, Transfer models.Transfers) error {
+		return dispatchTransferLines(c, tx, Transfer)
+	})
+}
+
+func ReceiveTransfer(c *gin.Context) {
+	changeTransferStatus(c, []string{models.TransferStatusInTransit}, models.TransferStatusReceived, func(tx *gorm.DB, Transfer models.Transfers) error {
+		return receiveTransferLines(c, tx, Transfer)
+	})
+}
+
+func CancelTransfer(c *gin.Context) {
+	changeTransferStatus(c, []string{models.TransferStatusDraft, models.TransferStatusInTransit}, models.TransferStatusCancelled, func(tx *gorm.DB, Transfer models.Transfers) error {
+		// stock already on the road goes back to the source warehouse
+		if Transfer.Status != models.TransferStatusInTransit {
+			return nil
+		}
+
+		return returnTransferLines(c, tx, Transfer)
+	})
+}
+
+func GetInTransit(c *gin.Context) {
+	db := database.GetDB()
+
+	inTransit := []helpers.InTransitResponse{}
+
+	query := db.Debug().Model(&models.TransferLines{}).
+		Select("transfer_lines.product_id, transfers.source_warehouse_id, transfers.destination_warehouse_id, SUM(transfer_lines.base_qty) AS qty").
+		Joins("JOIN transfers ON transfers.id = transfer_lines.transfer_id").
+		Where("transfers.status = ?", models.TransferStatusInTransit).
+		Group("transfer_lines.product_id, transfers.source_warehouse_id, transfers.destination_warehouse_id")
+
+	if productId := c.Query("product_id"); productId != "" {
+		query = query.Where("transfer_lines.product_id = ?", productId)
+	}
+
+	if err := query.Scan(&inTransit).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, inTransit)
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetUnitConversions(c *gin.Context) {
+	db := database.GetDB()
+
+	productId, err := strconv.Atoi(c.Param("productId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	unitConversions := []models.UnitConversions{}
+	if err := db.Debug().Where("product_id = ?", productId).Find(&unitConversions).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, unitConversions)
+}
+
+func CreateUnitConversion(c *gin.Context) {
+	db := database.GetDB()
+	contentType := helpers.GetContentType(c)
+
+	productId, err := strconv.Atoi(c.Param("productId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	UnitConversion := models.UnitConversions{}
+
+	if contentType == appJSON {
+		c.ShouldBindJSON(&UnitConversion)
+	} else {
+		c.ShouldBind(&UnitConversion)
+	}
+
+	Product := models.Products{}
+	if err := db.Debug().Where("id = ?", productId).First(&Product).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Product Not Found",
+		})
+
+		return
+	}
+
+	if UnitConversion.Unit == Product.Unit {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Unit is already the base unit of the product",
+		})
+
+		return
+	}
+
+	UnitConversion.ProductID = Product.ID
+
+	tx := db.Begin()
+
+	if err := tx.Debug().Create(&UnitConversion).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntityUnitConversion, UnitConversion.ID, nil, UnitConversion); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, UnitConversion)
+}
+
+func DeleteUnitConversion(c *gin.Context) {
+	db := database.GetDB()
+
+	productId, err := strconv.Atoi(c.Param("productId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	unitId, err := strconv.Atoi(c.Param("unitId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	UnitConversion := models.UnitConversions{}
+	if err := db.Debug().Where("id = ? AND product_id = ?", unitId, productId).First(&UnitConversion).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	// items keep their normalized base quantity, so removing a unit doesn't touch the ledger
+	if err := tx.Debug().Delete(&UnitConversion).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionDelete, models.AuditEntityUnitConversion, UnitConversion.ID, UnitConversion, nil); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Successfully deleted unit conversion",
+	})
+}
@@ -1,13 +1,19 @@
 package controllers
 
 import (
-	"github.com/golang-jwt/jwt"
 	"inventoryapp/database"
 	"inventoryapp/helpers"
+	"inventoryapp/loginguard"
 	"inventoryapp/models"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -35,9 +41,51 @@ func UserRegister(c *gin.Context) {
 		c.ShouldBind(&User)
 	}
 
-	err := db.Debug().Create(&User).Error
+	tx := db.Begin()
+
+	// nobody picks their own role, the first user of a fresh install administers it and everyone after starts as viewer.
+	// The table lock keeps two first registrations from both becoming admin
+	var userCount int64
+	if err := tx.Exec("LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	tx.Debug().Model(&models.Users{}).Count(&userCount)
+
+	User.Role = models.RoleViewer
+	if userCount == 0 {
+		User.Role = models.RoleAdmin
+	}
+
+	err := tx.Debug().Create(&User).Error
 
 	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionRegister, models.AuditEntityUser, User.ID, nil, User.Response()); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Bad Request",
 			"message": err.Error(),
@@ -46,10 +94,11 @@ func UserRegister(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"id":       User.ID,
-		"username": User.Username,
-		"email":    User.Email,
+	c.JSON(http.StatusCreated, helpers.RegisterResponse{
+		ID:       User.ID,
+		Username: User.Username,
+		Email:    User.Email,
+		Role:     User.Role,
 	})
 }
 
@@ -68,10 +117,36 @@ func UserLogin(c *gin.Context) {
 	}
 
 	password = User.Password
+	email := User.Email
 
-	err := db.Debug().Where("email = ?", User.Email).Take(&User).Error
+	// the sign-in is counted before the password is even looked at, throttled and locked out ones are turned away
+	wait, err := loginguard.Attempt(email, c.ClientIP())
 
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "Too Many Requests",
+			"message": "Too many failed sign-ins, try again later",
+		})
+
+		return
+	}
+
+	err = db.Debug().Where("email = ?", email).Take(&User).Error
+
+	// an unknown email counts as a failure too, so lockouts don't tell which accounts exist
+	if err != nil || !helpers.ComparePass([]byte(User.Password), []byte(password)) || User.ServiceAccount {
+		failLogin(c, email)
+
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Unauthorized",
 			"message": "Invalid email or password",
@@ -80,26 +155,266 @@ func UserLogin(c *gin.Context) {
 		return
 	}
 
-	comparePass := helpers.ComparePass([]byte(User.Password), []byte(password))
+	if err := loginguard.Succeed(email, c.ClientIP()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
 
-	if !comparePass {
+		return
+	}
+
+	Tokens, err := issueTokens(db, User, helpers.RandomToken(16))
+
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	UserResponse := User.Response()
+	Tokens.User = &UserResponse
+
+	c.JSON(http.StatusOK, Tokens)
+}
+
+// failLogin marks the counted sign-in as failed and audits the lockouts it caused, the failure is answered either way
+func failLogin(c *gin.Context, email string) {
+	db := database.GetDB()
+
+	lockouts, err := loginguard.Fail(email, c.ClientIP())
+
+	if err != nil {
+		log.Printf("loginguard: failing a sign-in failed: %s", err)
+		return
+	}
+
+	for _, Lockout := range lockouts {
+		entityType, entityID := models.AuditEntityLoginIP, uint(0)
+		after := gin.H{"ip": Lockout.IP, "failures": Lockout.Failures, "locked_until": Lockout.LockedUntil}
+
+		if Lockout.Email != "" {
+			User := models.Users{}
+			db.Debug().Where("email = ?", Lockout.Email).Limit(1).Find(&User)
+			entityType, entityID = models.AuditEntityUser, User.ID
+			after = gin.H{"email": Lockout.Email, "failures": Lockout.Failures, "locked_until": Lockout.LockedUntil}
+		}
+
+		if err := recordAudit(c, db, models.AuditActionLock, entityType, entityID, nil, after); err != nil {
+			log.Printf("loginguard: auditing a lockout failed: %s", err)
+		}
+	}
+}
+
+// issueTokens signs an access token for User and stores the next refresh token of familyID
+func issueTokens(tx *gorm.DB, User models.Users, familyID string) (helpers.LoginResponse, error) {
+	token, expiresAt := helpers.GenerateToken(User.ID, User.Email, User.Role)
+	refreshToken := helpers.RandomToken(32)
+
+	RefreshToken := models.RefreshTokens{
+		UserID:    User.ID,
+		FamilyID:  familyID,
+		TokenHash: helpers.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(helpers.RefreshTokenTTL()),
+	}
+
+	if err := tx.Debug().Create(&RefreshToken).Error; err != nil {
+		return helpers.LoginResponse{}, err
+	}
+
+	return helpers.LoginResponse{Token: token, ExpiresAt: expiresAt, RefreshToken: refreshToken}, nil
+}
+
+// revokeTokenFamily revokes every refresh token of familyID that isn't revoked yet
+func revokeTokenFamily(tx *gorm.DB, familyID string) error {
+	return tx.Debug().Model(&models.RefreshTokens{}).Where("family_id = ? AND revoked_at IS NULL", familyID).Update("revoked_at", time.Now()).Error
+}
+
+// UserRefresh trades a refresh token for a new access token and the next refresh token. A refresh token
+// works once, showing a used one again revokes its family and the user has to sign in again
+func UserRefresh(c *gin.Context) {
+	db := database.GetDB()
+
+	RefreshInput := helpers.RefreshInput{}
+
+	if err := c.ShouldBindJSON(&RefreshInput); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	RefreshToken := models.RefreshTokens{}
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", helpers.HashToken(RefreshInput.RefreshToken)).First(&RefreshToken).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"error":   "Unauthorized",
-			"message": "Invalid email or password",
+			"message": "Invalid refresh token",
 		})
 
 		return
 	}
 
-	token := helpers.GenerateToken(User.ID, User.Email)
+	if RefreshToken.UsedAt != nil || RefreshToken.RevokedAt != nil {
+		// the revocation has to stick even though the request fails
+		if err := revokeTokenFamily(tx, RefreshToken.FamilyID); err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  User,
-	})
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "Refresh token was already used, sign in again",
+		})
+
+		return
+	}
+
+	if time.Now().After(RefreshToken.ExpiresAt) {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "Refresh token expired, sign in again",
+		})
+
+		return
+	}
+
+	User := models.Users{}
+	if err := tx.Debug().Where("id = ?", RefreshToken.UserID).Take(&User).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "Invalid refresh token",
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Model(&RefreshToken).Update("used_at", time.Now()).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	// the new pair carries the current role of the user
+	Tokens, err := issueTokens(tx, User, RefreshToken.FamilyID)
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Tokens)
 }
 
+// UserLogout denylists the access token until it expires and revokes the family of the refresh token, if given
 func UserLogout(c *gin.Context) {
+	db := database.GetDB()
+
+	RefreshInput := helpers.RefreshInput{}
+
+	// the body is optional, without it only the access token is signed out
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&RefreshInput); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": err.Error(),
+			})
+
+			return
+		}
+	}
+
+	jti, expiresAt := helpers.GetTokenID(c)
+
+	// API keys have no token to sign out, they are revoked instead
+	if jti == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Only tokens can sign out, revoke the API key instead",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	// denied tokens that expired meanwhile aren't needed anymore
+	if err := tx.Debug().Where("expires_at < ?", time.Now()).Delete(&models.RevokedTokens{}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Debug().Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedTokens{JTI: jti, ExpiresAt: expiresAt}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if RefreshInput.RefreshToken != "" {
+		RefreshToken := models.RefreshTokens{}
+		result := tx.Debug().Where("token_hash = ? AND user_id = ?", helpers.HashToken(RefreshInput.RefreshToken), helpers.GetUserID(c)).Find(&RefreshToken)
+
+		if result.Error == nil && result.RowsAffected > 0 {
+			result.Error = revokeTokenFamily(tx, RefreshToken.FamilyID)
+		}
+
+		if result.Error != nil {
+			tx.Rollback()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": result.Error.Error(),
+			})
+
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Logout success",
 	})
@@ -109,7 +424,7 @@ func UserProfile(c *gin.Context) {
 	db := database.GetDB()
 	User := models.Users{}
 
-	claims, err := helpers.VerifyToken(c)
+	err := db.Debug().Where("id = ?", helpers.GetUserID(c)).Take(&User).Error
 
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
@@ -120,17 +435,189 @@ func UserProfile(c *gin.Context) {
 		return
 	}
 
-	err = db.Debug().Where("id = ?", claims.(jwt.MapClaims)["id"]).Take(&User).Error
+	c.JSON(http.StatusOK, User.Response())
+}
+
+// UpdateUserRole gives a user another role, it takes effect with the next token of the user.
+// Admins can't change their own role so there is always one left
+func UpdateUserRole(c *gin.Context) {
+	db := database.GetDB()
+
+	userId, err := strconv.Atoi(c.Param("userId"))
 
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-			"error":   "Unauthorized",
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	RoleInput := helpers.UserRoleInput{}
+
+	if err := c.ShouldBindJSON(&RoleInput); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if !models.IsUserRole(RoleInput.Role) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Unknown role " + RoleInput.Role,
+		})
+
+		return
+	}
+
+	if uint(userId) == helpers.GetUserID(c) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "You can't change your own role",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	User := models.Users{}
+	if err := tx.Debug().Where("id = ?", userId).First(&User).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	if User.ServiceAccount && RoleInput.Role == models.RoleAdmin {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Service accounts can't be admins",
+		})
+
+		return
+	}
+
+	before := User.Response()
+
+	if err := tx.Debug().Model(&User).Update("role", RoleInput.Role).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionUpdate, models.AuditEntityUser, User.ID, before, User.Response()); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
 			"message": err.Error(),
 		})
 
 		return
 	}
 
-	c.JSON(http.StatusOK, User)
+	c.JSON(http.StatusOK, User.Response())
+}
+
+// UnlockUser lifts the lockout of a user after too many failed sign-ins
+func UnlockUser(c *gin.Context) {
+	db := database.GetDB()
+
+	userId, err := strconv.Atoi(c.Param("userId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	User := models.Users{}
+	if err := db.Debug().Where("id = ?", userId).First(&User).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	if err := loginguard.Unlock(User.Email); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, db, models.AuditActionUnlock, models.AuditEntityUser, User.ID, nil, User.Response()); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, User.Response())
+}
+
+// UnlockIP lifts the lockout of a client IP after too many failed sign-ins from it
+func UnlockIP(c *gin.Context) {
+	db := database.GetDB()
+
+	ip := net.ParseIP(c.Param("ip"))
+
+	if ip == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	if err := loginguard.UnlockIP(ip.String()); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, db, models.AuditActionUnlock, models.AuditEntityLoginIP, 0, nil, gin.H{"ip": ip.String()}); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
 
+	c.JSON(http.StatusOK, gin.H{"ip": ip.String()})
 }
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetWarehouses(c *gin.Context) {
+	db := database.GetDB()
+	warehouses := []models.Warehouses{}
+	warehouseId := c.Param("warehouseId")
+
+	if warehouseId != "" {
+		id, err := strconv.Atoi(warehouseId)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		result := db.Where("id = ?", id).Find(&warehouses)
+		count := result.RowsAffected
+		if result.Error != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		if count < 1 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Data Not Found",
+				"message": "Data Doesn't Exist",
+			})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, warehouses[0])
+		return
+	}
+
+	if err := db.Find(&warehouses).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, warehouses)
+}
+
+func CreateWarehouse(c *gin.Context) {
+	db := database.GetDB()
+	contentType := helpers.GetContentType(c)
+
+	Warehouse := models.Warehouses{}
+
+	if contentType == appJSON {
+		c.ShouldBindJSON(&Warehouse)
+	} else {
+		c.ShouldBind(&Warehouse)
+	}
+
+	tx := db.Begin()
+
+	if err := tx.Debug().Create(&Warehouse).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntityWarehouse, Warehouse.ID, nil, Warehouse); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Warehouse)
+}
+
+func UpdateWarehouse(c *gin.Context) {
+	db := database.GetDB()
+	contentType := helpers.GetContentType(c)
+
+	Warehouse := models.Warehouses{}
+
+	warehouseId, _ := strconv.Atoi(c.Param("warehouseId"))
+
+	if contentType == appJSON {
+		c.ShouldBindJSON(&Warehouse)
+	} else {
+		c.ShouldBind(&Warehouse)
+	}
+
+	Warehouse.ID = uint(warehouseId)
+
+	tx := db.Begin()
+
+	previousWarehouse := models.Warehouses{}
+	if err := tx.Debug().Where("id = ?", warehouseId).First(&previousWarehouse).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	err := tx.Model(&Warehouse).Where("id = ?", warehouseId).Updates(models.Warehouses{Code: Warehouse.Code, Name: Warehouse.Name, Address: Warehouse.Address}).Error
+
+	if err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	UpdatedWarehouse := models.Warehouses{}
+	if err := tx.Debug().First(&UpdatedWarehouse, warehouseId).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionUpdate, models.AuditEntityWarehouse, UpdatedWarehouse.ID, previousWarehouse, UpdatedWarehouse); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Warehouse)
+}
+
+func DeleteWarehouse(c *gin.Context) {
+	db := database.GetDB()
+	warehouseId, err := strconv.Atoi(c.Param("warehouseId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	Warehouse := models.Warehouses{}
+	if err := db.Debug().Where("id = ?", warehouseId).First(&Warehouse).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	// a warehouse still holding stock can't go away, move or issue the stock first
+	var stockedCount int64
+	db.Model(&models.ProductStocks{}).Where("warehouse_id = ? AND stock <> 0", warehouseId).Count(&stockedCount)
+
+	if stockedCount > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Warehouse still holds stock",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	// warehouses are referenced by the ledger, so they are only archived
+	if err := tx.Delete(&Warehouse).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionArchive, models.AuditEntityWarehouse, Warehouse.ID, Warehouse, nil); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Successfully archived warehouse",
+		"warehouse": Warehouse,
+	})
+}
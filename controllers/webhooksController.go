@@ -0,0 +1,409 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"inventoryapp/database"
+	"inventoryapp/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newWebhookSecret is the secret of a subscription created without one
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// webhookAuditSnapshot is the subscription as the audit log keeps it, never with its secret
+func webhookAuditSnapshot(Subscription models.WebhookSubscriptions) models.WebhookSubscriptions {
+	Subscription.Secret = ""
+
+	return Subscription
+}
+
+// the secret is only answered when the subscription is created
+func hideWebhookSecrets(subscriptions []models.WebhookSubscriptions) {
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+}
+
+func GetWebhooks(c *gin.Context) {
+	db := database.GetDB()
+	subscriptions := []models.WebhookSubscriptions{}
+	webhookId := c.Param("webhookId")
+
+	if webhookId != "" {
+		id, err := strconv.Atoi(webhookId)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		result := db.Debug().Where("id = ?", id).Find(&subscriptions)
+		count := result.RowsAffected
+		if result.Error != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Bad Request",
+				"message": "Invalid Parameter",
+			})
+
+			return
+		}
+
+		if count < 1 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Data Not Found",
+				"message": "Data Doesn't Exist",
+			})
+
+			return
+		}
+
+		hideWebhookSecrets(subscriptions)
+
+		c.JSON(http.StatusOK, subscriptions[0])
+		return
+	}
+
+	query := db.Debug()
+
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("? = ANY(event_types)", eventType)
+	}
+
+	if err := query.Find(&subscriptions).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	hideWebhookSecrets(subscriptions)
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+func CreateWebhook(c *gin.Context) {
+	db := database.GetDB()
+
+	Subscription := models.WebhookSubscriptions{}
+
+	if err := c.ShouldBindJSON(&Subscription); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if Subscription.Secret == "" {
+		secret, err := newWebhookSecret()
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal Server Error",
+				"message": err.Error(),
+			})
+
+			return
+		}
+
+		Subscription.Secret = secret
+	}
+
+	tx := db.Begin()
+
+	if err := tx.Debug().Create(&Subscription).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionCreate, models.AuditEntityWebhook, Subscription.ID, nil, webhookAuditSnapshot(Subscription)); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Subscription)
+}
+
+// UpdateWebhook changes url, event types and whether the subscription is disabled, the secret only changes when given
+func UpdateWebhook(c *gin.Context) {
+	db := database.GetDB()
+
+	Subscription := models.WebhookSubscriptions{}
+	webhookId, _ := strconv.Atoi(c.Param("webhookId"))
+
+	if err := c.ShouldBindJSON(&Subscription); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	previousSubscription := models.WebhookSubscriptions{}
+	if err := tx.Debug().Where("id = ?", webhookId).First(&previousSubscription).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	changes := map[string]interface{}{
+		"url":         Subscription.URL,
+		"event_types": Subscription.EventTypes,
+		"disabled":    Subscription.Disabled,
+	}
+
+	if Subscription.Secret != "" {
+		changes["secret"] = Subscription.Secret
+	}
+
+	before := webhookAuditSnapshot(previousSubscription)
+	previousSubscription.URL, previousSubscription.EventTypes = Subscription.URL, Subscription.EventTypes
+
+	if err := tx.Debug().Model(&previousSubscription).Updates(changes).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	previousSubscription.Secret = ""
+
+	if err := recordAudit(c, tx, models.AuditActionUpdate, models.AuditEntityWebhook, previousSubscription.ID, before, previousSubscription); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, previousSubscription)
+}
+
+func DeleteWebhook(c *gin.Context) {
+	db := database.GetDB()
+	webhookId, err := strconv.Atoi(c.Param("webhookId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	Subscription := models.WebhookSubscriptions{}
+	if err := tx.Debug().Where("id = ?", webhookId).First(&Subscription).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	// the delivery log keeps pointing at the subscription, so subscriptions are only archived
+	if err := tx.Delete(&Subscription).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal Server Error",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	Subscription.Secret = ""
+
+	if err := recordAudit(c, tx, models.AuditActionArchive, models.AuditEntityWebhook, Subscription.ID, Subscription, nil); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Successfully archived webhook",
+		"webhook": Subscription,
+	})
+}
+
+// GetWebhookDeliveries is the delivery log of a subscription, newest first
+func GetWebhookDeliveries(c *gin.Context) {
+	db := database.GetDB()
+
+	webhookId, err := strconv.Atoi(c.Param("webhookId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	query := db.Debug().Where("webhook_subscription_id = ?", webhookId).Order("id DESC")
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	deliveries := []models.WebhookDeliveries{}
+	if err := query.Find(&deliveries).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook queues a delivery again right away, with a fresh set of attempts
+func RedeliverWebhook(c *gin.Context) {
+	db := database.GetDB()
+
+	webhookId, _ := strconv.Atoi(c.Param("webhookId"))
+	deliveryId, err := strconv.Atoi(c.Param("deliveryId"))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": "Invalid Parameter",
+		})
+
+		return
+	}
+
+	tx := db.Begin()
+
+	Delivery := models.WebhookDeliveries{}
+	if err := tx.Debug().Where("id = ? AND webhook_subscription_id = ?", deliveryId, webhookId).First(&Delivery).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Data Not Found",
+			"message": "Data Doesn't Exist",
+		})
+
+		return
+	}
+
+	before := Delivery
+
+	if err := tx.Debug().Model(&Delivery).Updates(map[string]interface{}{
+		"status":          models.WebhookDeliveryStatusPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := recordAudit(c, tx, models.AuditActionRedeliver, models.AuditEntityWebhookDelivery, Delivery.ID, before, Delivery); err != nil {
+		tx.Rollback()
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Bad Request",
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, Delivery)
+}
@@ -0,0 +1,325 @@
+// Package costing values stock and costs the goods issued under the cost method of each product by replaying
+// the ledger one source document at a time, in the order the documents first moved stock. Every document counts
+// with its net quantity, so updating or cancelling an incoming item re-costs everything issued after it.
+// Receipts without a cost of their own (opening stock, counted surplus) come in at the running unit cost.
+// Transfers only move stock between warehouses and are left out, stock in transit keeps its value
+package costing
+
+import (
+	"encoding/json"
+	"inventoryapp/models"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+type layer struct {
+	Qty      decimal.Decimal `json:"qty"`
+	UnitCost decimal.Decimal `json:"unit_cost"`
+}
+
+// state is the cost state of a product after a document. Deficit is stock issued on backorder, it was costed
+// at LastCost and the next receipts fill it first
+type state struct {
+	Layers   []layer         `json:"layers"`
+	Deficit  decimal.Decimal `json:"deficit"`
+	LastCost decimal.Decimal `json:"last_cost"`
+}
+
+// document is the net quantity one source document moved of a product, FirstID is its first movement
+type document struct {
+	SourceType string
+	SourceID   uint
+	FirstID    uint
+	Qty        decimal.Decimal
+}
+
+// Costs is what replaying the ledger of one product yields, CostOfGoods is keyed by outgoing item
+type Costs struct {
+	Qty         decimal.Decimal
+	Value       decimal.Decimal
+	CostOfGoods map[uint]decimal.Decimal
+}
+
+// documents answers the documents of productID after the movement afterID in ledger order, scoped further by query
+func documents(db *gorm.DB, productID uint, afterID uint, scope func(*gorm.DB) *gorm.DB) ([]document, error) {
+	docs := []document{}
+
+	err := scope(db.Debug().Model(&models.StockMovements{}).
+		Select("source_type, source_id, MIN(id) AS first_id, SUM(qty) AS qty").
+		Where("product_id = ? AND source_type <> ?", productID, models.MovementSourceTransfer).
+		Group("source_type, source_id").
+		Having("MIN(id) > ?", afterID)).
+		Order("first_id").
+		Scan(&docs).Error
+
+	return docs, err
+}
+
+// baseUnitCosts answers the cost of one base unit of the incoming items among docs, an item priced per box
+// spreads the price over the pieces in it
+func baseUnitCosts(db *gorm.DB, docs []document) (map[uint]decimal.Decimal, error) {
+	costs := map[uint]decimal.Decimal{}
+	ids := []uint{}
+
+	for _, Document := range docs {
+		if Document.SourceType == models.MovementSourceIncomingItem {
+			ids = append(ids, Document.SourceID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return costs, nil
+	}
+
+	incomingItems := []models.IncomingItems{}
+	if err := db.Debug().Select("id", "qty", "base_qty", "unit_cost").Where("id IN ?", ids).Find(&incomingItems).Error; err != nil {
+		return nil, err
+	}
+
+	for _, IncomingItem := range incomingItems {
+		if IncomingItem.BaseQty.IsPositive() {
+			costs[IncomingItem.ID] = IncomingItem.UnitCost.Mul(IncomingItem.Qty).Div(IncomingItem.BaseQty)
+		}
+	}
+
+	return costs, nil
+}
+
+// apply moves State past Document and answers the cost of what it issued
+func (State *state) apply(costMethod string, Document document, unitCosts map[uint]decimal.Decimal) decimal.Decimal {
+	if Document.Qty.IsPositive() {
+		unitCost, ok := unitCosts[Document.SourceID]
+
+		if Document.SourceType != models.MovementSourceIncomingItem || !ok {
+			unitCost = State.LastCost
+		}
+
+		qty := Document.Qty
+		covered := decimal.Min(State.Deficit, qty)
+		State.Deficit = State.Deficit.Sub(covered)
+		qty = qty.Sub(covered)
+
+		if qty.IsPositive() {
+			State.Layers = append(State.Layers, layer{Qty: qty, UnitCost: unitCost})
+		}
+
+		// a moving average keeps a single layer at the weighted unit cost
+		if costMethod == models.CostMethodAverage && len(State.Layers) > 1 {
+			totalQty, totalValue := decimal.Zero, decimal.Zero
+
+			for _, Layer := range State.Layers {
+				totalQty = totalQty.Add(Layer.Qty)
+				totalValue = totalValue.Add(Layer.Qty.Mul(Layer.UnitCost))
+			}
+
+			State.Layers = []layer{{Qty: totalQty, UnitCost: totalValue.Div(totalQty)}}
+		}
+
+		if len(State.Layers) > 0 {
+			State.LastCost = State.Layers[len(State.Layers)-1].UnitCost
+		}
+
+		return decimal.Zero
+	}
+
+	remaining := Document.Qty.Neg()
+	cost := decimal.Zero
+
+	for len(State.Layers) > 0 && remaining.IsPositive() {
+		take := decimal.Min(State.Layers[0].Qty, remaining)
+		cost = cost.Add(take.Mul(State.Layers[0].UnitCost))
+		State.LastCost = State.Layers[0].UnitCost
+		remaining = remaining.Sub(take)
+		State.Layers[0].Qty = State.Layers[0].Qty.Sub(take)
+
+		if !State.Layers[0].Qty.IsPositive() {
+			State.Layers = State.Layers[1:]
+		}
+	}
+
+	if remaining.IsPositive() {
+		cost = cost.Add(remaining.Mul(State.LastCost))
+		State.Deficit = State.Deficit.Add(remaining)
+	}
+
+	return cost.Round(6)
+}
+
+// Value values the stock of Product at asOf under its cost method, replaying its whole ledger up to asOf
+func Value(db *gorm.DB, Product models.Products, asOf time.Time) (Costs, error) {
+	Result := Costs{Qty: decimal.Zero, Value: decimal.Zero, CostOfGoods: map[uint]decimal.Decimal{}}
+
+	docs, err := documents(db, Product.ID, 0, func(query *gorm.DB) *gorm.DB {
+		return query.Where("moved_at <= ?", asOf)
+	})
+
+	if err != nil {
+		return Result, err
+	}
+
+	unitCosts, err := baseUnitCosts(db, docs)
+
+	if err != nil {
+		return Result, err
+	}
+
+	State := state{Deficit: decimal.Zero, LastCost: decimal.Zero}
+
+	for _, Document := range docs {
+		if Document.Qty.IsZero() {
+			continue
+		}
+
+		cost := State.apply(Product.CostMethod, Document, unitCosts)
+
+		if Document.SourceType == models.MovementSourceOutgoingItem {
+			Result.CostOfGoods[Document.SourceID] = cost
+		}
+	}
+
+	for _, Layer := range State.Layers {
+		Result.Qty = Result.Qty.Add(Layer.Qty)
+		Result.Value = Result.Value.Add(Layer.Qty.Mul(Layer.UnitCost))
+	}
+
+	Result.Qty = Result.Qty.Sub(State.Deficit)
+	Result.Value = Result.Value.Sub(State.Deficit.Mul(State.LastCost)).Round(6)
+
+	return Result, nil
+}
+
+// Recost re-costs the ledger of productID from the document sourceType/sourceID onward, stores the cost of goods
+// of the outgoing items issued from there where it changed and answers the cost of every one of them. Booking an
+// outgoing item costs it, updating or cancelling an item re-costs the items issued after it.
+// tx has to hold the lock of the product
+func Recost(tx *gorm.DB, productID uint, sourceType string, sourceID uint) (map[uint]decimal.Decimal, error) {
+	var firstID uint
+
+	if err := tx.Debug().Model(&models.StockMovements{}).Select("COALESCE(MIN(id), 0)").
+		Where("product_id = ? AND source_type = ? AND source_id = ?", productID, sourceType, sourceID).
+		Scan(&firstID).Error; err != nil {
+		return nil, err
+	}
+
+	return recostFrom(tx, productID, firstID)
+}
+
+// RecostAll re-costs the whole ledger of productID, the cost method changed or its items were never costed.
+// tx has to hold the lock of the product
+func RecostAll(tx *gorm.DB, productID uint) (map[uint]decimal.Decimal, error) {
+	return recostFrom(tx, productID, 0)
+}
+
+// recostFrom replays the documents from the last snapshot before the movement fromID, a document of the ledger
+// that moved stock after that snapshot without being costed is picked up on the way
+func recostFrom(tx *gorm.DB, productID uint, fromID uint) (map[uint]decimal.Decimal, error) {
+	Product := models.Products{}
+	if err := tx.Debug().Unscoped().Where("id = ?", productID).First(&Product).Error; err != nil {
+		return nil, err
+	}
+
+	State := state{Deficit: decimal.Zero, LastCost: decimal.Zero}
+	var afterID uint
+
+	if fromID > 0 {
+		Snapshot := models.CostSnapshots{}
+		result := tx.Debug().Where("product_id = ? AND first_movement_id < ?", productID, fromID).Order("first_movement_id DESC").Limit(1).Find(&Snapshot)
+
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			if err := json.Unmarshal(Snapshot.State, &State); err != nil {
+				return nil, err
+			}
+
+			afterID = Snapshot.FirstMovementID
+		}
+	}
+
+	if err := tx.Debug().Where("product_id = ? AND first_movement_id > ?", productID, afterID).Delete(&models.CostSnapshots{}).Error; err != nil {
+		return nil, err
+	}
+
+	docs, err := documents(tx, productID, afterID, func(query *gorm.DB) *gorm.DB {
+		return query
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	unitCosts, err := baseUnitCosts(tx, docs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	costs := map[uint]decimal.Decimal{}
+	snapshots := []models.CostSnapshots{}
+
+	for _, Document := range docs {
+		cost := decimal.Zero
+
+		// a cancelled document moves nothing, a cancelled outgoing item costs nothing
+		if !Document.Qty.IsZero() {
+			cost = State.apply(Product.CostMethod, Document, unitCosts)
+
+			encoded, err := json.Marshal(State)
+
+			if err != nil {
+				return nil, err
+			}
+
+			snapshots = append(snapshots, models.CostSnapshots{
+				ProductID:       productID,
+				FirstMovementID: Document.FirstID,
+				SourceType:      Document.SourceType,
+				SourceID:        Document.SourceID,
+				State:           models.RawJSON(encoded),
+			})
+		}
+
+		if Document.SourceType == models.MovementSourceOutgoingItem {
+			costs[Document.SourceID] = cost
+		}
+	}
+
+	if len(snapshots) > 0 {
+		if err := tx.Debug().CreateInBatches(&snapshots, 500).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if len(costs) == 0 {
+		return costs, nil
+	}
+
+	ids := make([]uint, 0, len(costs))
+	for id := range costs {
+		ids = append(ids, id)
+	}
+
+	outgoingItems := []models.OutgoingItems{}
+	if err := tx.Debug().Select("id", "cost_of_goods").Where("id IN ?", ids).Find(&outgoingItems).Error; err != nil {
+		return nil, err
+	}
+
+	for _, OutgoingItem := range outgoingItems {
+		costOfGoods := costs[OutgoingItem.ID]
+
+		if OutgoingItem.CostOfGoods != nil && OutgoingItem.CostOfGoods.Equal(costOfGoods) {
+			continue
+		}
+
+		// UpdateColumn skips the hooks, only the cost changes
+		if err := tx.Debug().Model(&OutgoingItem).UpdateColumn("cost_of_goods", costOfGoods).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return costs, nil
+}
@@ -0,0 +1,52 @@
+package costing
+
+import (
+	"inventoryapp/models"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func replay(costMethod string, docs []document, unitCosts map[uint]decimal.Decimal) (state, []decimal.Decimal) {
+	State := state{Deficit: decimal.Zero, LastCost: decimal.Zero}
+	costs := []decimal.Decimal{}
+
+	for _, Document := range docs {
+		costs = append(costs, State.apply(costMethod, Document, unitCosts))
+	}
+
+	return State, costs
+}
+
+func TestIssuesAreCostedUnderTheCostMethod(t *testing.T) {
+	docs := []document{
+		{SourceType: models.MovementSourceIncomingItem, SourceID: 1, Qty: decimal.NewFromInt(10)},
+		{SourceType: models.MovementSourceIncomingItem, SourceID: 2, Qty: decimal.NewFromInt(10)},
+		{SourceType: models.MovementSourceOutgoingItem, SourceID: 1, Qty: decimal.NewFromInt(-15)},
+	}
+	unitCosts := map[uint]decimal.Decimal{1: decimal.NewFromInt(2), 2: decimal.NewFromInt(4)}
+
+	for costMethod, want := range map[string]string{models.CostMethodFIFO: "40", models.CostMethodAverage: "45"} {
+		_, costs := replay(costMethod, docs, unitCosts)
+
+		if !costs[2].Equal(decimal.RequireFromString(want)) {
+			t.Errorf("%s costs the issue at %s, want %s", costMethod, costs[2], want)
+		}
+	}
+}
+
+func TestBackorderedStockIsFilledByTheNextReceipt(t *testing.T) {
+	State, costs := replay(models.CostMethodFIFO, []document{
+		{SourceType: models.MovementSourceIncomingItem, SourceID: 1, Qty: decimal.NewFromInt(5)},
+		{SourceType: models.MovementSourceOutgoingItem, SourceID: 1, Qty: decimal.NewFromInt(-8)},
+		{SourceType: models.MovementSourceIncomingItem, SourceID: 2, Qty: decimal.NewFromInt(10)},
+	}, map[uint]decimal.Decimal{1: decimal.NewFromInt(3), 2: decimal.NewFromInt(5)})
+
+	if !costs[1].Equal(decimal.NewFromInt(24)) {
+		t.Fatalf("the backordered issue costs %s, want 24", costs[1])
+	}
+
+	if !State.Deficit.IsZero() || len(State.Layers) != 1 || !State.Layers[0].Qty.Equal(decimal.NewFromInt(7)) {
+		t.Fatalf("the receipt left %+v", State)
+	}
+}
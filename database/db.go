@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"inventoryapp/costing"
 	"inventoryapp/models"
 	"log"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -33,7 +35,13 @@ func StartDB() {
 	sslMode := os.Getenv("PGSSLMODE")
 
 	config := fmt.Sprintf("host=%s user=%s password=%s port=%s dbname=%s sslmode=%s", host, user, password, dbPort, dbName, sslMode)
-	db, err = gorm.Open(postgres.Open(config), &gorm.Config{})
+	Connect(config)
+}
+
+// Connect opens the database at dsn, migrates it and backfills what older versions left behind.
+// StartDB connects with the PG* settings, tests pass their own database
+func Connect(dsn string) {
+	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
 
 	if err != nil {
 		log.Fatal("error connecting to database", err)
@@ -42,12 +50,177 @@ func StartDB() {
 	fmt.Println("successfully connecting to database")
 	db.Debug().AutoMigrate(
 		&models.Users{},
+		&models.Warehouses{},
+		&models.Suppliers{},
+		&models.Customers{},
 		&models.Products{},
+		&models.ProductStocks{},
+		&models.UnitConversions{},
+		&models.PurchaseOrders{},
+		&models.PurchaseOrderLines{},
 		&models.IncomingItems{},
+		&models.SalesOrders{},
+		&models.SalesOrderLines{},
 		&models.OutgoingItems{},
+		&models.StockLots{},
+		&models.StockMovements{},
+		&models.CostSnapshots{},
+		&models.SerialNumbers{},
+		&models.SerialMovements{},
+		&models.Transfers{},
+		&models.TransferLines{},
+		&models.StockCounts{},
+		&models.StockCountLines{},
+		&models.StockCountEntries{},
+		&models.OutboxEmails{},
+		&models.AlertDeliveries{},
+		&models.WebhookSubscriptions{},
+		&models.WebhookDeliveries{},
+		&models.OutboxEvents{},
+		&models.AuditLogs{},
+		&models.RefreshTokens{},
+		&models.RevokedTokens{},
+		&models.APIKeys{},
+		&models.LoginAttempts{},
 	)
+
+	backfillDefaultWarehouse()
+	backfillStockLots()
+	backfillOpeningMovements()
+	backfillCostOfGoods()
+	backfillAPIKeyScopes()
+	backfillAdmin()
+}
+
+// backfillDefaultWarehouse moves stock recorded before warehouses existed into a MAIN warehouse,
+// it only runs while there is no warehouse at all
+func backfillDefaultWarehouse() {
+	var count int64
+	db.Model(&models.Warehouses{}).Unscoped().Count(&count)
+
+	if count > 0 {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		Warehouse := models.Warehouses{Code: "MAIN", Name: "Main Warehouse"}
+		if err := tx.Create(&Warehouse).Error; err != nil {
+			return err
+		}
+
+		// UpdateColumn skips the hooks, stock movements refuse regular updates
+		for _, model := range []interface{}{&models.IncomingItems{}, &models.OutgoingItems{}, &models.StockMovements{}} {
+			if err := tx.Model(model).Where("warehouse_id IS NULL").UpdateColumn("warehouse_id", Warehouse.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.StockMovements{}).Where("warehouse_id = ?", Warehouse.ID).UpdateColumn("warehouse_balance_after", gorm.Expr("balance_after")).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec("INSERT INTO product_stocks (product_id, warehouse_id, stock, created_at, updated_at) SELECT id, ?, stock, NOW(), NOW() FROM products WHERE stock <> 0", Warehouse.ID).Error
+	})
+
+	if err != nil {
+		log.Fatal("error creating default warehouse", err)
+	}
+}
+
+// backfillStockLots gives every warehouse balance recorded before lots existed a lot without a number
+// and points its stock movements at it
+func backfillStockLots() {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT INTO stock_lots (product_id, warehouse_id, lot_number, stock, created_at, updated_at) SELECT product_id, warehouse_id, '', stock, NOW(), NOW() FROM product_stocks WHERE NOT EXISTS (SELECT 1 FROM stock_lots WHERE stock_lots.product_id = product_stocks.product_id AND stock_lots.warehouse_id = product_stocks.warehouse_id)").Error; err != nil {
+			return err
+		}
+
+		// UpdateColumn skips the hooks, stock movements refuse regular updates
+		return tx.Model(&models.StockMovements{}).Where("stock_lot_id IS NULL").UpdateColumn("stock_lot_id", gorm.Expr("(SELECT stock_lots.id FROM stock_lots WHERE stock_lots.product_id = stock_movements.product_id AND stock_lots.warehouse_id = stock_movements.warehouse_id AND stock_lots.lot_number = '')")).Error
+	})
+
+	if err != nil {
+		log.Fatal("error backfilling stock lots", err)
+	}
+}
+
+// backfillOpeningMovements books the stock of a lot its movements don't account for, stock recorded before
+// the ledger existed, as an opening adjustment dated when the product was created. Once booked the movements
+// add up and nothing is left to backfill
+func backfillOpeningMovements() {
+	err := db.Exec(`INSERT INTO stock_movements (product_id, warehouse_id, stock_lot_id, qty, balance_after, warehouse_balance_after, source_type, source_id, action, reason_code, user_id, moved_at, created_at, updated_at)
+		SELECT stock_lots.product_id, stock_lots.warehouse_id, stock_lots.id,
+			stock_lots.stock - COALESCE((SELECT SUM(qty) FROM stock_movements WHERE stock_lot_id = stock_lots.id), 0),
+			products.stock - COALESCE((SELECT SUM(qty) FROM stock_movements WHERE product_id = products.id), 0),
+			product_stocks.stock - COALESCE((SELECT SUM(qty) FROM stock_movements WHERE product_id = products.id AND warehouse_id = stock_lots.warehouse_id), 0),
+			?, products.id, ?, ?, NULL, COALESCE(products.created_at, NOW()), NOW(), NOW()
+		FROM stock_lots
+		JOIN products ON products.id = stock_lots.product_id
+		JOIN product_stocks ON product_stocks.product_id = stock_lots.product_id AND product_stocks.warehouse_id = stock_lots.warehouse_id
+		WHERE stock_lots.stock <> COALESCE((SELECT SUM(qty) FROM stock_movements WHERE stock_lot_id = stock_lots.id), 0)`,
+		models.MovementSourceProduct, models.MovementActionAdjusted, models.ReasonOpeningBalance).Error
+
+	if err != nil {
+		log.Fatal("error backfilling opening stock movements", err)
+	}
+}
+
+// backfillCostOfGoods costs the outgoing items booked before the cost of goods was stored, one product at a
+// time under its lock. Once costed every item carries its cost and listing items never writes
+func backfillCostOfGoods() {
+	productIDs := []uint{}
+	if err := db.Model(&models.OutgoingItems{}).Unscoped().Distinct("product_id").Where("cost_of_goods IS NULL").Pluck("product_id", &productIDs).Error; err != nil {
+		log.Fatal("error backfilling cost of goods", err)
+	}
+
+	for _, productID := range productIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// archived products keep their items, so the lock reaches them as well
+			if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", productID).First(&models.Products{}).Error; err != nil {
+				return err
+			}
+
+			_, err := costing.RecostAll(tx, productID)
+
+			return err
+		})
+
+		if err != nil {
+			log.Fatal("error backfilling cost of goods", err)
+		}
+	}
+}
+
+// backfillAPIKeyScopes turns the resource names keys were scoped to before reading and writing were told apart
+// into both scopes of the resource, so the keys keep doing what they did
+func backfillAPIKeyScopes() {
+	err := db.Exec(`UPDATE api_keys SET scopes = ARRAY(
+			SELECT DISTINCT scope FROM (
+				SELECT scope FROM unnest(api_keys.scopes) scope WHERE scope LIKE '%:%'
+				UNION SELECT resource || access FROM unnest(api_keys.scopes) resource, unnest(ARRAY[':read', ':write']) access WHERE resource NOT LIKE '%:%'
+			) scopes ORDER BY scope)
+		WHERE EXISTS (SELECT 1 FROM unnest(api_keys.scopes) scope WHERE scope NOT LIKE '%:%')`).Error
+
+	if err != nil {
+		log.Fatal("error backfilling api key scopes", err)
+	}
 }
 
 func GetDB() *gorm.DB {
 	return db
 }
+
+// backfillAdmin makes the first user admin when users were registered before roles existed,
+// everyone else starts as viewer until an admin gives them a role
+func backfillAdmin() {
+	var count int64
+	db.Model(&models.Users{}).Where("role = ?", models.RoleAdmin).Count(&count)
+
+	if count > 0 {
+		return
+	}
+
+	if err := db.Exec("UPDATE users SET role = ? WHERE id = (SELECT MIN(id) FROM users)", models.RoleAdmin).Error; err != nil {
+		log.Fatal("error backfilling admin", err)
+	}
+}
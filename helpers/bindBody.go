@@ -0,0 +1,33 @@
+package helpers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BindWithoutUserID binds the JSON body into obj, refusing a body that names a user_id on itself or on any of
+// its items. Whoever acts is always the signed in user
+func BindWithoutUserID(c *gin.Context, obj interface{}) error {
+	var body interface{}
+
+	if err := c.ShouldBindBodyWithJSON(&body); err != nil {
+		return err
+	}
+
+	items, ok := body.([]interface{})
+
+	if !ok {
+		items = []interface{}{body}
+	}
+
+	for _, item := range items {
+		if fields, ok := item.(map[string]interface{}); ok {
+			if _, ok := fields["user_id"]; ok {
+				return errors.New("You always act as yourself, leave user_id out")
+			}
+		}
+	}
+
+	return c.ShouldBindBodyWithJSON(obj)
+}
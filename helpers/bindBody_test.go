@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type item struct {
+	ProductID uint `json:"product_id"`
+	Qty       int  `json:"qty"`
+}
+
+func TestBindWithoutUserIDRefusesAnyUserID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for body, refused := range map[string]bool{
+		`{"product_id": 1, "qty": 2}`:                          false,
+		`{"product_id": 1, "qty": 2, "user_id": 7}`:            true,
+		`{"product_id": 1, "qty": 2, "user_id": null}`:         true,
+		`[{"product_id": 1}, {"product_id": 2}]`:               false,
+		`[{"product_id": 1}, {"product_id": 2, "user_id": 0}]`: true,
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		var err error
+
+		if strings.HasPrefix(body, "[") {
+			err = BindWithoutUserID(c, &[]item{})
+		} else {
+			Item := item{}
+			err = BindWithoutUserID(c, &Item)
+
+			if err == nil && Item.ProductID != 1 {
+				t.Errorf("%s bound product %d", body, Item.ProductID)
+			}
+		}
+
+		if (err != nil) != refused {
+			t.Errorf("%s answered %v", body, err)
+		}
+	}
+}
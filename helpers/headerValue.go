@@ -2,6 +2,16 @@ package helpers
 
 import "github.com/gin-gonic/gin"
 
+const RequestIDHeader = "X-Request-ID"
+
 func GetContentType(c *gin.Context) string {
 	return c.Request.Header.Get("Content-Type")
 }
+
+// GetRequestID is the id middlewares.RequestID gave the request
+func GetRequestID(c *gin.Context) string {
+	return c.GetString("requestId")
+}
+
+// APIKeyHeader carries the API key of a service account, instead of a bearer token
+const APIKeyHeader = "X-API-Key"
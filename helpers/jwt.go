@@ -1,28 +1,74 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 )
 
-var secretKey = "password"
+// accessTokenTTL is how long an access token is valid, ACCESS_TOKEN_TTL overrides the 15 minutes
+func accessTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+
+	return 15 * time.Minute
+}
+
+// RefreshTokenTTL is how long a refresh token is valid, REFRESH_TOKEN_TTL overrides the 30 days
+func RefreshTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+
+	return 30 * 24 * time.Hour
+}
+
+// RandomToken is n random bytes hex encoded, for token ids and refresh tokens
+func RandomToken(n int) string {
+	token := make([]byte, n)
+	rand.Read(token)
+
+	return hex.EncodeToString(token)
+}
+
+// HashToken is what the database keeps of a refresh token, the token itself is only known to the client
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// GenerateToken signs a short-lived access token, its jti lets logout revoke it before it expires
+func GenerateToken(id uint, email string, role string) (string, time.Time) {
+	expiresAt := time.Now().Add(accessTokenTTL())
 
-func GenerateToken(id uint, email string) string {
 	claims := jwt.MapClaims{
 		"id":    id,
 		"email": email,
+		"role":  role,
+		"jti":   RandomToken(16),
+		"iat":   time.Now().Unix(),
+		"exp":   expiresAt.Unix(),
 	}
 
-	parseToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// the kid tells verifiers which key signed, so keys can rotate without invalidating tokens
+	parseToken := jwt.NewWithClaims(currentKey.method, claims)
+	parseToken.Header["kid"] = currentKey.kid
 
-	signedToken, _ := parseToken.SignedString([]byte(secretKey))
+	signedToken, _ := parseToken.SignedString(currentKey.signKey)
 
-	return signedToken
+	return signedToken, expiresAt
 }
 
+// VerifyToken parses the bearer token of the request, tokens without expiry are refused
 func VerifyToken(c *gin.Context) (interface{}, error) {
 	errResponse := errors.New("Sign in to proceed")
 	headerToken := c.Request.Header.Get("Authorization")
@@ -33,17 +79,112 @@ func VerifyToken(c *gin.Context) (interface{}, error) {
 	}
 
 	stringsToken := strings.Split(headerToken, " ")[1]
-	token, _ := jwt.Parse(stringsToken, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errResponse
-		}
+	token, err := jwt.Parse(stringsToken, verificationKey)
 
-		return []byte(secretKey), nil
-	})
+	if err != nil || !token.Valid {
+		return nil, errResponse
+	}
 
-	if _, ok := token.Claims.(jwt.MapClaims); !ok && !token.Valid {
+	claims, ok := token.Claims.(jwt.MapClaims)
+
+	if !ok || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
 		return nil, errResponse
 	}
 
-	return token.Claims.(jwt.MapClaims), nil
+	return claims, nil
+}
+
+// GetTokenID is the jti and expiry of the access token of the signed in user
+func GetTokenID(c *gin.Context) (string, time.Time) {
+	userData, ok := c.Get("userData")
+
+	if !ok {
+		return "", time.Time{}
+	}
+
+	claims, ok := userData.(jwt.MapClaims)
+
+	if !ok {
+		return "", time.Time{}
+	}
+
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+
+	return jti, time.Unix(int64(exp), 0)
+}
+
+func GetUserID(c *gin.Context) uint {
+	userData, ok := c.Get("userData")
+
+	if !ok {
+		return 0
+	}
+
+	claims, ok := userData.(jwt.MapClaims)
+
+	if !ok {
+		return 0
+	}
+
+	id, _ := claims["id"].(float64)
+
+	return uint(id)
+}
+
+// GetUserRole is the role in the token of the signed in user, empty for tokens issued before roles existed
+func GetUserRole(c *gin.Context) string {
+	userData, ok := c.Get("userData")
+
+	if !ok {
+		return ""
+	}
+
+	claims, ok := userData.(jwt.MapClaims)
+
+	if !ok {
+		return ""
+	}
+
+	role, _ := claims["role"].(string)
+
+	return role
+}
+
+// GetAPIKeyID is the API key the request authenticated with, 0 for a token
+func GetAPIKeyID(c *gin.Context) uint {
+	userData, ok := c.Get("userData")
+
+	if !ok {
+		return 0
+	}
+
+	claims, ok := userData.(jwt.MapClaims)
+
+	if !ok {
+		return 0
+	}
+
+	id, _ := claims["api_key_id"].(float64)
+
+	return uint(id)
+}
+
+// GetAPIKeyScopes are the scopes of the API key of the request, nil for a token
+func GetAPIKeyScopes(c *gin.Context) []string {
+	userData, ok := c.Get("userData")
+
+	if !ok {
+		return nil
+	}
+
+	claims, ok := userData.(jwt.MapClaims)
+
+	if !ok {
+		return nil
+	}
+
+	scopes, _ := claims["scopes"].([]string)
+
+	return scopes
 }
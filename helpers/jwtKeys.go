@@ -0,0 +1,203 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// signingKey is one configured JWT key, verifyKey is the secret itself for HS256
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+var (
+	signingKeys = map[string]signingKey{}
+	currentKey  signingKey
+)
+
+// JWK is a public key as published in the JWKS
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadSigningKeys reads the JWT keys from JWT_KEYS, a comma separated list of kid:alg:value where value is the
+// secret for HS256 and the path of a private key PEM file for RS256 and EdDSA. Every listed key verifies tokens,
+// JWT_SIGNING_KID picks the one that signs and defaults to the last, so a key is rotated in by appending it and
+// retired by removing it once the tokens it signed expired. A single JWT_SECRET is the HS256 key "default"
+func LoadSigningKeys() error {
+	entries := strings.Split(os.Getenv("JWT_KEYS"), ",")
+
+	if os.Getenv("JWT_KEYS") == "" && os.Getenv("JWT_SECRET") != "" {
+		entries = []string{"default:HS256:" + os.Getenv("JWT_SECRET")}
+	}
+
+	keys := map[string]signingKey{}
+	var last signingKey
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return errors.New("JWT_KEYS entries must look like kid:alg:value")
+		}
+
+		key, err := loadSigningKey(parts[0], parts[1], parts[2])
+
+		if err != nil {
+			return err
+		}
+
+		if _, ok := keys[key.kid]; ok {
+			return errors.New("JWT key " + key.kid + " is configured twice")
+		}
+
+		keys[key.kid] = key
+		last = key
+	}
+
+	if len(keys) == 0 {
+		return errors.New("No JWT signing key configured, set JWT_KEYS or JWT_SECRET")
+	}
+
+	current := last
+
+	if kid := os.Getenv("JWT_SIGNING_KID"); kid != "" {
+		key, ok := keys[kid]
+
+		if !ok {
+			return errors.New("JWT_SIGNING_KID " + kid + " is not in JWT_KEYS")
+		}
+
+		current = key
+	}
+
+	signingKeys, currentKey = keys, current
+
+	return nil
+}
+
+func loadSigningKey(kid, alg, value string) (signingKey, error) {
+	switch alg {
+	case "HS256":
+		if len(value) < 32 {
+			return signingKey{}, errors.New("JWT key " + kid + " needs a secret of at least 32 characters")
+		}
+
+		return signingKey{kid: kid, method: jwt.SigningMethodHS256, signKey: []byte(value), verifyKey: []byte(value)}, nil
+	case "RS256":
+		pem, err := os.ReadFile(value)
+
+		if err != nil {
+			return signingKey{}, err
+		}
+
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+
+		if err != nil {
+			return signingKey{}, errors.New("JWT key " + kid + ": " + err.Error())
+		}
+
+		return signingKey{kid: kid, method: jwt.SigningMethodRS256, signKey: privateKey, verifyKey: &privateKey.PublicKey}, nil
+	case "EdDSA":
+		pem, err := os.ReadFile(value)
+
+		if err != nil {
+			return signingKey{}, err
+		}
+
+		privateKey, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+
+		if err != nil {
+			return signingKey{}, errors.New("JWT key " + kid + ": " + err.Error())
+		}
+
+		edKey, ok := privateKey.(ed25519.PrivateKey)
+
+		if !ok {
+			return signingKey{}, errors.New("JWT key " + kid + " is not an Ed25519 key")
+		}
+
+		return signingKey{kid: kid, method: jwt.SigningMethodEdDSA, signKey: edKey, verifyKey: edKey.Public()}, nil
+	}
+
+	return signingKey{}, errors.New("JWT key " + kid + " has unsupported algorithm " + alg)
+}
+
+// verificationKey is the keyfunc of jwt.Parse, the token has to name a configured key and use its algorithm
+func verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := signingKeys[kid]
+
+	if !ok || t.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("Sign in to proceed")
+	}
+
+	return key.verifyKey, nil
+}
+
+// JWKS are the public keys of the asymmetric signing keys, HS256 secrets are never published
+func JWKS() JWKSResponse {
+	response := JWKSResponse{Keys: []JWK{}}
+
+	kids := []string{}
+	for kid := range signingKeys {
+		kids = append(kids, kid)
+	}
+
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		key := signingKeys[kid]
+
+		switch publicKey := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			response.Keys = append(response.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			response.Keys = append(response.Keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+
+	return response
+}
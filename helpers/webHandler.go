@@ -1,6 +1,10 @@
 package helpers
 
-import "time"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 type RegisterInput struct {
 	Username string `json:"username"`
@@ -12,6 +16,22 @@ type RegisterResponse struct {
 	ID       uint   `json:"id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+// UserResponse is a user as every response shows it, whatever else is stored about the user stays inside
+type UserResponse struct {
+	ID             uint       `json:"id"`
+	Username       string     `json:"username"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	ServiceAccount bool       `json:"service_account"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+type UserRoleInput struct {
+	Role string `json:"role" binding:"required"`
 }
 
 type LoginInput struct {
@@ -20,26 +40,113 @@ type LoginInput struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string        `json:"token"`
+	ExpiresAt    time.Time     `json:"expires_at"`
+	RefreshToken string        `json:"refresh_token"`
+	User         *UserResponse `json:"user,omitempty"`
+}
+
+type ServiceAccountInput struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+type APIKeyInput struct {
+	UserID     uint       `json:"user_id" binding:"required"`
+	Name       string     `json:"name" binding:"required"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 type ProductInput struct {
-	Name  string `json:"name" valid:"required"`
-	Stock uint8  `json:"stock"`
+	Name           string          `json:"name" valid:"required"`
+	Stock          decimal.Decimal `json:"stock"`
+	Unit           string          `json:"unit"`
+	AllowBackorder bool            `json:"allow_backorder"`
+	Serialized     bool            `json:"serialized"`
+	CostMethod     string          `json:"cost_method"`
+	ReorderPoint   decimal.Decimal `json:"reorder_point"`
+	SafetyStock    decimal.Decimal `json:"safety_stock"`
+	ReorderQty     decimal.Decimal `json:"reorder_qty"`
 }
 
 type IncomingItemInput struct {
-	Qty        string    `json:"qty" valid:"required"`
-	IncomingAt time.Time `json:"incoming_at" valid:"required"`
-	UserID     uint      `json:"user_id" valid:"required"`
-	ProductID  uint      `json:"product_id" valid:"required"`
+	Qty                 string    `json:"qty" valid:"required"`
+	Unit                string    `json:"unit"`
+	UnitCost            string    `json:"unit_cost"`
+	SupplierID          uint      `json:"supplier_id"`
+	SupplierReference   string    `json:"supplier_reference"`
+	PurchaseOrderLineID uint      `json:"purchase_order_line_id"`
+	IncomingAt          time.Time `json:"incoming_at" valid:"required"`
+	UserID              uint      `json:"user_id" valid:"required"`
+	ProductID           uint      `json:"product_id" valid:"required"`
+	Serials             []string  `json:"serials"`
 }
 
 type OutgoingItemInput struct {
-	Qty        string    `json:"qty" valid:"required"`
-	OutgoingAt time.Time `json:"outgoing_at" valid:"required"`
-	UserID     uint      `json:"user_id" valid:"required"`
-	ProductID  uint      `json:"product_id" valid:"required"`
+	Qty              string    `json:"qty" valid:"required"`
+	Unit             string    `json:"unit"`
+	CustomerID       uint      `json:"customer_id"`
+	SalesOrderLineID uint      `json:"sales_order_line_id"`
+	ShippingAddress  string    `json:"shipping_address"`
+	OutgoingAt       time.Time `json:"outgoing_at" valid:"required"`
+	UserID           uint      `json:"user_id" valid:"required"`
+	ProductID        uint      `json:"product_id" valid:"required"`
+	Serials          []string  `json:"serials"`
+}
+
+type InTransitResponse struct {
+	ProductID              uint            `json:"product_id"`
+	SourceWarehouseID      uint            `json:"source_warehouse_id"`
+	DestinationWarehouseID uint            `json:"destination_warehouse_id"`
+	Qty                    decimal.Decimal `json:"qty"`
+}
+
+type StockCountInput struct {
+	WarehouseID uint   `json:"warehouse_id" valid:"required"`
+	ProductIDs  []uint `json:"product_ids"`
+	Note        string `json:"note"`
+}
+
+type StockCountEntryInput struct {
+	ProductID uint            `json:"product_id" valid:"required"`
+	Qty       decimal.Decimal `json:"qty" valid:"required"`
+	Unit      string          `json:"unit"`
+}
+
+type StockCountPostInput struct {
+	// ReasonCode applies to every line that doesn't name its own in Lines
+	ReasonCode string                      `json:"reason_code"`
+	Lines      []StockCountLineReasonInput `json:"lines"`
+}
+
+type StockCountLineReasonInput struct {
+	ProductID  uint   `json:"product_id"`
+	ReasonCode string `json:"reason_code"`
+}
+
+type StockCountVarianceResponse struct {
+	ProductID   uint             `json:"product_id"`
+	FrozenQty   decimal.Decimal  `json:"frozen_qty"`
+	MovedQty    decimal.Decimal  `json:"moved_qty"`
+	ExpectedQty decimal.Decimal  `json:"expected_qty"`
+	CountedQty  *decimal.Decimal `json:"counted_qty"`
+	VarianceQty *decimal.Decimal `json:"variance_qty"`
+	CountedAt   *time.Time       `json:"counted_at"`
+}
+
+// OverReservedResponse is how much sales orders reserved beyond the stock of a product in a warehouse
+type OverReservedResponse struct {
+	ProductID   uint            `json:"product_id"`
+	WarehouseID uint            `json:"warehouse_id"`
+	Shortfall   decimal.Decimal `json:"shortfall"`
+	SourceType  string          `json:"source_type"`
+	SourceID    uint            `json:"source_id"`
 }
 
 type DeleteResponse struct {
@@ -50,3 +157,52 @@ type APIError struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
 }
+
+type ValuationResponse struct {
+	AsOf       time.Time                  `json:"as_of"`
+	TotalValue decimal.Decimal            `json:"total_value"`
+	Products   []ProductValuationResponse `json:"products"`
+}
+
+type ProductValuationResponse struct {
+	ProductID  uint            `json:"product_id"`
+	Name       string          `json:"name"`
+	Unit       string          `json:"unit"`
+	CostMethod string          `json:"cost_method"`
+	Qty        decimal.Decimal `json:"qty"`
+	UnitCost   decimal.Decimal `json:"unit_cost"`
+	Value      decimal.Decimal `json:"value"`
+}
+
+type CustomerTotalsResponse struct {
+	CustomerID       uint                           `json:"customer_id"`
+	From             string                         `json:"from,omitempty"`
+	To               string                         `json:"to,omitempty"`
+	ItemCount        int                            `json:"item_count"`
+	TotalCostOfGoods decimal.Decimal                `json:"total_cost_of_goods"`
+	Products         []CustomerProductTotalResponse `json:"products"`
+}
+
+type CustomerProductTotalResponse struct {
+	ProductID   uint            `json:"product_id"`
+	Name        string          `json:"name"`
+	Unit        string          `json:"unit"`
+	ItemCount   int             `json:"item_count"`
+	Qty         decimal.Decimal `json:"qty"`
+	CostOfGoods decimal.Decimal `json:"cost_of_goods"`
+}
+
+// LowStockResponse is a product below its reorder point. SuggestedQty tops stock and what is on order
+// up to the reorder point, ordering at least ReorderQty
+type LowStockResponse struct {
+	ProductID        uint            `json:"product_id"`
+	Name             string          `json:"name"`
+	Unit             string          `json:"unit"`
+	Stock            decimal.Decimal `json:"stock"`
+	ReorderPoint     decimal.Decimal `json:"reorder_point"`
+	SafetyStock      decimal.Decimal `json:"safety_stock"`
+	ReorderQty       decimal.Decimal `json:"reorder_qty"`
+	OnOrder          decimal.Decimal `json:"on_order"`
+	BelowSafetyStock bool            `json:"below_safety_stock"`
+	SuggestedQty     decimal.Decimal `json:"suggested_qty"`
+}
@@ -0,0 +1,247 @@
+// Package loginguard slows down and locks out guessing passwords. Sign-ins are counted per account and per
+// client IP before the password is checked and forgiven when it was right, so a burst of parallel guesses can't
+// slip past the count. From the third failure on every next attempt has to wait twice as long as the one before,
+// and too many failures lock the account or IP for a while. The counts live in a Store
+package loginguard
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Attempts are the failed sign-ins of one key since the last success, within Window
+type Attempts struct {
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+// Store keeps the attempts, see MemoryStore for a single instance and PostgresStore for several
+type Store interface {
+	// Update replaces the attempts of key with what update makes of them, without other updates of key in between.
+	// update gets attempts without failures when there are none
+	Update(key string, update func(Attempts) Attempts) (Attempts, error)
+	// Reset forgets the attempts of key
+	Reset(key string) error
+}
+
+// Policy is how many failures are tolerated and what follows them
+type Policy struct {
+	// an account or an IP is locked for Lockout after MaxAccountFailures or MaxIPFailures failures within Window,
+	// an IP gets more since several people may share it
+	MaxAccountFailures int
+	MaxIPFailures      int
+	Window             time.Duration
+	Lockout            time.Duration
+	// from ThrottleAfter failures of an account, or IPThrottleAfter of an IP, the next attempt waits BaseDelay,
+	// doubled with every failure up to MaxDelay
+	ThrottleAfter   int
+	IPThrottleAfter int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+}
+
+var DefaultPolicy = Policy{
+	MaxAccountFailures: 5,
+	MaxIPFailures:      20,
+	Window:             15 * time.Minute,
+	Lockout:            15 * time.Minute,
+	ThrottleAfter:      3,
+	IPThrottleAfter:    12,
+	BaseDelay:          time.Second,
+	MaxDelay:           time.Minute,
+}
+
+var (
+	current Store  = NewMemoryStore()
+	policy  Policy = DefaultPolicy
+)
+
+// Use replaces the store attempts are kept in
+func Use(s Store) {
+	current = s
+}
+
+// Setup picks the store named by LOGIN_GUARD_STORE: memory (the default) or postgres, and reads
+// LOGIN_MAX_ACCOUNT_FAILURES, LOGIN_MAX_IP_FAILURES and LOGIN_LOCKOUT over the default policy
+func Setup(db *gorm.DB) error {
+	switch os.Getenv("LOGIN_GUARD_STORE") {
+	case "", "memory":
+		Use(NewMemoryStore())
+	case "postgres":
+		Use(PostgresStore{DB: db})
+	default:
+		return errors.New("LOGIN_GUARD_STORE must be one of memory or postgres")
+	}
+
+	policy = DefaultPolicy
+
+	if max, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ACCOUNT_FAILURES")); err == nil && max > 0 {
+		policy.MaxAccountFailures = max
+	}
+
+	if max, err := strconv.Atoi(os.Getenv("LOGIN_MAX_IP_FAILURES")); err == nil && max > 0 {
+		policy.MaxIPFailures = max
+		// an IP is throttled at the same share of its failures as by default
+		policy.IPThrottleAfter = max * DefaultPolicy.IPThrottleAfter / DefaultPolicy.MaxIPFailures
+	}
+
+	if lockout, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT")); err == nil && lockout > 0 {
+		policy.Lockout = lockout
+	}
+
+	return nil
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// wait is how long key has to wait before its next attempt, from throttleAfter failures on it is throttled
+func wait(attempts Attempts, throttleAfter int, now time.Time) time.Duration {
+	if attempts.LockedUntil != nil && attempts.LockedUntil.After(now) {
+		return attempts.LockedUntil.Sub(now)
+	}
+
+	if attempts.Failures < throttleAfter || now.Sub(attempts.LastFailedAt) > policy.Window {
+		return 0
+	}
+
+	delay := policy.MaxDelay
+
+	if shift := attempts.Failures - throttleAfter; shift < 16 {
+		delay = policy.BaseDelay << shift
+	}
+
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	return attempts.LastFailedAt.Add(delay).Sub(now)
+}
+
+// Attempt counts a sign-in as email from ip before its password is checked, and answers how long it has to wait
+// instead, 0 when it may go ahead. An attempt turned away by the account is still counted for the IP and the
+// other way around
+func Attempt(email, ip string) (time.Duration, error) {
+	now := time.Now()
+	longest := time.Duration(0)
+
+	for _, check := range []struct {
+		key           string
+		throttleAfter int
+	}{
+		{accountKey(email), policy.ThrottleAfter},
+		{ipKey(ip), policy.IPThrottleAfter},
+	} {
+		_, err := current.Update(check.key, func(attempts Attempts) Attempts {
+			if now.Sub(attempts.LastFailedAt) > policy.Window {
+				attempts.Failures = 0
+			}
+
+			if w := wait(attempts, check.throttleAfter, now); w > 0 {
+				if w > longest {
+					longest = w
+				}
+
+				return attempts
+			}
+
+			attempts.Failures++
+			attempts.LastFailedAt = now
+
+			return attempts
+		})
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return longest, nil
+}
+
+// Lockout is an account or IP that just got locked
+type Lockout struct {
+	Email       string
+	IP          string
+	Failures    int
+	LockedUntil time.Time
+}
+
+// Fail marks the attempt of email from ip as failed, it was counted already, and answers what it locked
+func Fail(email, ip string) ([]Lockout, error) {
+	now := time.Now()
+	lockouts := []Lockout{}
+
+	for _, check := range []struct {
+		key         string
+		maxFailures int
+		lockout     Lockout
+	}{
+		{accountKey(email), policy.MaxAccountFailures, Lockout{Email: email}},
+		{ipKey(ip), policy.MaxIPFailures, Lockout{IP: ip}},
+	} {
+		locked := false
+
+		attempts, err := current.Update(check.key, func(attempts Attempts) Attempts {
+			locked = attempts.Failures >= check.maxFailures && (attempts.LockedUntil == nil || !attempts.LockedUntil.After(now))
+
+			if locked {
+				lockedUntil := now.Add(policy.Lockout)
+				attempts.LockedUntil = &lockedUntil
+			}
+
+			return attempts
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if locked {
+			check.lockout.Failures, check.lockout.LockedUntil = attempts.Failures, *attempts.LockedUntil
+			lockouts = append(lockouts, check.lockout)
+		}
+	}
+
+	return lockouts, nil
+}
+
+// Succeed forgets the failures of the account and takes back the attempt counted for the IP, earlier failures
+// of the IP keep counting so one known password doesn't open the way to guess others
+func Succeed(email, ip string) error {
+	if err := current.Reset(accountKey(email)); err != nil {
+		return err
+	}
+
+	_, err := current.Update(ipKey(ip), func(attempts Attempts) Attempts {
+		if attempts.Failures > 0 {
+			attempts.Failures--
+		}
+
+		return attempts
+	})
+
+	return err
+}
+
+// Unlock lifts the lockout of the account and forgets its failures
+func Unlock(email string) error {
+	return current.Reset(accountKey(email))
+}
+
+// UnlockIP lifts the lockout of a client IP and forgets its failures
+func UnlockIP(ip string) error {
+	return current.Reset(ipKey(ip))
+}
@@ -0,0 +1,139 @@
+package loginguard
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAttemptCountsParallelSignInsBeforeTheyAreChecked(t *testing.T) {
+	Use(NewMemoryStore())
+	policy = DefaultPolicy
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	allowed := 0
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			wait, err := Attempt("someone@example.com", "203.0.113.7")
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if allowed != policy.ThrottleAfter {
+		t.Fatalf("%d parallel sign-ins went ahead, want %d", allowed, policy.ThrottleAfter)
+	}
+}
+
+func TestFailLocksOnceAndSucceedGivesTheIPAttemptBack(t *testing.T) {
+	Use(NewMemoryStore())
+	policy = DefaultPolicy
+	policy.ThrottleAfter = 100
+	policy.IPThrottleAfter = 100
+
+	email, ip := "someone@example.com", "203.0.113.7"
+
+	for i := 1; i <= policy.MaxAccountFailures; i++ {
+		if _, err := Attempt(email, ip); err != nil {
+			t.Fatal(err)
+		}
+
+		lockouts, err := Fail(email, ip)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := i == policy.MaxAccountFailures; (len(lockouts) == 1) != want {
+			t.Fatalf("failure %d locked %v", i, lockouts)
+		}
+	}
+
+	if wait, _ := Attempt(email, ip); wait == 0 {
+		t.Fatal("a locked account may sign in")
+	}
+
+	if err := Unlock(email); err != nil {
+		t.Fatal(err)
+	}
+
+	before, _ := current.Update(ipKey(ip), func(attempts Attempts) Attempts { return attempts })
+
+	if wait, _ := Attempt(email, ip); wait != 0 {
+		t.Fatalf("an unlocked account waits %s", wait)
+	}
+
+	if err := Succeed(email, ip); err != nil {
+		t.Fatal(err)
+	}
+
+	after, _ := current.Update(ipKey(ip), func(attempts Attempts) Attempts { return attempts })
+
+	if after.Failures != before.Failures {
+		t.Fatalf("a successful sign-in left %d failures of the IP, want %d", after.Failures, before.Failures)
+	}
+}
+
+func TestAnIPIsThrottledLaterThanAnAccount(t *testing.T) {
+	Use(NewMemoryStore())
+	policy = DefaultPolicy
+
+	ip := "203.0.113.7"
+
+	// people behind one address sign in as different accounts, each fails less than it takes to throttle it
+	for i := 0; i < policy.IPThrottleAfter; i++ {
+		email := fmt.Sprintf("someone%d@example.com", i)
+
+		if wait, err := Attempt(email, ip); err != nil || wait != 0 {
+			t.Fatalf("sign-in %d from the IP waits %s, %v", i+1, wait, err)
+		}
+
+		if _, err := Fail(email, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if wait, _ := Attempt("someone-else@example.com", ip); wait == 0 {
+		t.Fatalf("the IP isn't throttled after %d failures", policy.IPThrottleAfter)
+	}
+}
+
+func TestMemoryStoreForgetsQuietAttempts(t *testing.T) {
+	policy = DefaultPolicy
+	store := NewMemoryStore()
+	now := time.Now()
+
+	store.attempts["account:quiet@example.com"] = Attempts{Key: "account:quiet@example.com", Failures: 2, LastFailedAt: now.Add(-2 * policy.Window)}
+	store.attempts["account:recent@example.com"] = Attempts{Key: "account:recent@example.com", Failures: 2, LastFailedAt: now}
+	store.sweptAt = now.Add(-sweepInterval)
+
+	if _, err := store.Update("account:someone@example.com", func(attempts Attempts) Attempts { return attempts }); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.attempts["account:quiet@example.com"]; ok {
+		t.Fatal("the sweep kept attempts that went quiet")
+	}
+
+	if _, ok := store.attempts["account:recent@example.com"]; !ok {
+		t.Fatal("the sweep forgot recent attempts")
+	}
+}
@@ -0,0 +1,64 @@
+package loginguard
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore forgets the attempts that went quiet
+const sweepInterval = time.Minute
+
+// MemoryStore keeps attempts in the process, enough for a single instance of the API
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+	sweptAt  time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]Attempts{}}
+}
+
+func (s *MemoryStore) Update(key string, update func(Attempts) Attempts) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// forget whatever went quiet, so the map doesn't only grow. Sweeping on every update would walk all keys
+	// for every sign-in
+	if now.Sub(s.sweptAt) >= sweepInterval {
+		s.sweep(now)
+	}
+
+	attempts, ok := s.attempts[key]
+
+	if !ok {
+		attempts = Attempts{Key: key}
+	}
+
+	attempts = update(attempts)
+	attempts.Key = key
+	s.attempts[key] = attempts
+
+	return attempts, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for k, attempts := range s.attempts {
+		if now.Sub(attempts.LastFailedAt) > policy.Window && (attempts.LockedUntil == nil || attempts.LockedUntil.Before(now)) {
+			delete(s.attempts, k)
+		}
+	}
+
+	s.sweptAt = now
+}
@@ -0,0 +1,45 @@
+package loginguard
+
+import (
+	"inventoryapp/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresStore keeps attempts in the login_attempts table, so every instance of the API counts together
+type PostgresStore struct {
+	DB *gorm.DB
+}
+
+// Update holds a row lock on key while update runs, so concurrent sign-ins of one key are counted one after another
+func (s PostgresStore) Update(key string, update func(Attempts) Attempts) (Attempts, error) {
+	attempts := Attempts{Key: key}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		LoginAttempt := models.LoginAttempts{Key: key}
+
+		// the first attempts of a key need a row to wait on as well
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&LoginAttempt).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&LoginAttempt).Error; err != nil {
+			return err
+		}
+
+		attempts = update(Attempts(LoginAttempt))
+		attempts.Key = key
+		LoginAttempt = models.LoginAttempts(attempts)
+
+		return tx.Save(&LoginAttempt).Error
+	})
+
+	return attempts, err
+}
+
+func (s PostgresStore) Reset(key string) error {
+	// locks that ran out and failures that went quiet are cleaned up along the way
+	return s.DB.Where("key = ? OR (last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?))", key, time.Now().Add(-24*time.Hour), time.Now()).Delete(&models.LoginAttempts{}).Error
+}
@@ -2,9 +2,15 @@ package main
 
 import (
 	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/loginguard"
+	"inventoryapp/notifier"
+	"inventoryapp/outbox"
 	"inventoryapp/router"
+	"inventoryapp/webhooks"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -23,6 +29,27 @@ func main() {
 		PORT = "8080"
 	}
 
+	if err := helpers.LoadSigningKeys(); err != nil {
+		log.Fatal(err)
+	}
+
 	database.StartDB()
+
+	if err := notifier.Setup(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := loginguard.Setup(database.GetDB()); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := outbox.Setup(); err != nil {
+		log.Fatal(err)
+	}
+
+	outbox.StartDispatcher(database.GetDB(), time.Second)
+	webhooks.StartDispatcher(database.GetDB(), 5*time.Second)
+	notifier.StartDispatcher(database.GetDB(), 5*time.Second)
+
 	router.StartServer().Run("0.0.0.0:" + PORT)
 }
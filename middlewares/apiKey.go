@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"errors"
+	"inventoryapp/database"
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// authenticateAPIKey finds the key of the request and answers claims like a token of its service account would have
+func authenticateAPIKey(c *gin.Context, key string) (jwt.MapClaims, error) {
+	errResponse := errors.New("Invalid API key")
+	db := database.GetDB()
+
+	APIKey := models.APIKeys{}
+	if err := db.Debug().Preload("Users").Where("key_hash = ?", helpers.HashToken(key)).First(&APIKey).Error; err != nil {
+		return nil, errResponse
+	}
+
+	if APIKey.RevokedAt != nil || (APIKey.ExpiresAt != nil && time.Now().After(*APIKey.ExpiresAt)) {
+		return nil, errResponse
+	}
+
+	if APIKey.Users == nil || !APIKey.Users.ServiceAccount {
+		return nil, errResponse
+	}
+
+	if !APIKey.AllowsIP(c.ClientIP()) {
+		return nil, errors.New("API key isn't allowed from " + c.ClientIP())
+	}
+
+	// UpdateColumn skips the hooks and the updated_at of the key
+	db.Model(&APIKey).UpdateColumn("last_used_at", time.Now())
+
+	return jwt.MapClaims{
+		"id":         float64(APIKey.UserID),
+		"email":      APIKey.Users.Email,
+		"role":       APIKey.Users.Role,
+		"api_key_id": float64(APIKey.ID),
+		"scopes":     []string(APIKey.Scopes),
+	}, nil
+}
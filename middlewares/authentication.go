@@ -1,7 +1,9 @@
 package middlewares
 
 import (
+	"inventoryapp/database"
 	"inventoryapp/helpers"
+	"inventoryapp/models"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,6 +11,24 @@ import (
 
 func Authentication() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// service accounts send an API key instead of a token
+		if key := c.GetHeader(helpers.APIKeyHeader); key != "" {
+			claims, err := authenticateAPIKey(c, key)
+
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error":   "Unauthorized",
+					"message": err.Error(),
+				})
+
+				return
+			}
+
+			c.Set("userData", claims)
+			c.Next()
+			return
+		}
+
 		verifyToken, err := helpers.VerifyToken(c)
 		_ = verifyToken
 
@@ -21,6 +41,31 @@ func Authentication() gin.HandlerFunc {
 			return
 		}
 		c.Set("userData", verifyToken)
+
+		// a signed out token stays valid until it expires, unless it is on the denylist
+		jti, _ := helpers.GetTokenID(c)
+
+		var revoked int64
+
+		// a denylist we can't read might be hiding this token, so it isn't let through
+		if err := database.GetDB().Model(&models.RevokedTokens{}).Where("jti = ?", jti).Count(&revoked).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "Service Unavailable",
+				"message": "Can't verify the token right now, try again later",
+			})
+
+			return
+		}
+
+		if revoked > 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Unauthorized",
+				"message": "Sign in to proceed",
+			})
+
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -0,0 +1,65 @@
+package middlewares
+
+import (
+	"inventoryapp/helpers"
+	"inventoryapp/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permissions maps "METHOD /full/path" of a route to the roles allowed to call it
+type Permissions map[string][]string
+
+// Scopes are the API key scopes of the routes in p
+func (p Permissions) Scopes() map[string]bool {
+	scopes := map[string]bool{}
+
+	for route := range p {
+		method, fullPath, _ := strings.Cut(route, " ")
+		scopes[models.APIKeyScope(method, fullPath)] = true
+	}
+
+	return scopes
+}
+
+// Authorization lets the request through when the role of the signed in user may call the route,
+// a route missing from permissions is refused to everyone. An API key also has to be scoped to reading
+// or writing the resource of the route. It runs after Authentication
+func Authorization(permissions Permissions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := helpers.GetUserRole(c)
+
+		if inScope(c) {
+			for _, allowed := range permissions[c.Request.Method+" "+c.FullPath()] {
+				if role == allowed {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": "Your role isn't allowed to do this",
+		})
+	}
+}
+
+// inScope tells whether the API key of the request is scoped to the route, a token isn't scoped at all
+func inScope(c *gin.Context) bool {
+	if helpers.GetAPIKeyID(c) == 0 {
+		return true
+	}
+
+	required := models.APIKeyScope(c.Request.Method, c.FullPath())
+
+	for _, scope := range helpers.GetAPIKeyScopes(c) {
+		if scope == required {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"inventoryapp/helpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestID keeps the X-Request-ID the client sent or makes one up, and answers it back
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(helpers.RequestIDHeader)
+
+		if requestID == "" || len(requestID) > 128 {
+			id := make([]byte, 16)
+			rand.Read(id)
+			requestID = hex.EncodeToString(id)
+		}
+
+		c.Set("requestId", requestID)
+		c.Header(helpers.RequestIDHeader, requestID)
+		c.Next()
+	}
+}
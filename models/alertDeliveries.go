@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	AlertDeliveryStatusPending   = "pending"
+	AlertDeliveryStatusDelivered = "delivered"
+	AlertDeliveryStatusFailed    = "failed"
+)
+
+// AlertDeliveries is the queue and the log of the alerts handed to the notifier, an alert is retried with
+// exponential backoff until it is delivered or runs out of attempts. Alerts don't wait on each other
+type AlertDeliveries struct {
+	GormModel
+	AlertType     string     `gorm:"not null;index" json:"alert_type"`
+	ProductID     uint       `gorm:"not null;index" json:"product_id"`
+	Payload       RawJSON    `gorm:"type:jsonb;not null" json:"payload"`
+	Status        string     `gorm:"not null;index;default:pending" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index" json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
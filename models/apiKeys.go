@@ -0,0 +1,107 @@
+package models
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// APIKeys let a service account call the API without signing in. Only the hash of a key is kept, Prefix is the
+// part shown to tell keys apart. The key acts with the role of its service account, Scopes narrow it down to
+// reading or writing some resources (like "incoming-items:read") and AllowedIPs to some clients, empty allows all.
+// A key needs at least one scope, a key without any is refused everywhere
+type APIKeys struct {
+	GormModel
+	UserID     uint           `gorm:"not null;index" json:"user_id" valid:"required~Service account is required"`
+	Name       string         `gorm:"not null" json:"name" valid:"required~Your key name is required"`
+	Prefix     string         `gorm:"not null;uniqueIndex" json:"prefix"`
+	KeyHash    string         `gorm:"not null;uniqueIndex" json:"-"`
+	Scopes     pq.StringArray `gorm:"type:text[]" json:"scopes"`
+	AllowedIPs pq.StringArray `gorm:"type:text[]" json:"allowed_ips"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time     `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time     `json:"revoked_at,omitempty"`
+	Users      *Users         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// KnownAPIKeyScopes are the scopes of the routes, the router fills it from its permissions
+var KnownAPIKeyScopes = map[string]bool{}
+
+// APIKeyScope is the scope a route needs, its resource (the first path segment) and read for GET or write otherwise
+func APIKeyScope(method, fullPath string) string {
+	resource := strings.Split(strings.TrimPrefix(fullPath, "/"), "/")[0]
+
+	if method == http.MethodGet || method == http.MethodHead {
+		return resource + ":read"
+	}
+
+	return resource + ":write"
+}
+
+// AllowsIP tells whether ip is in the allowlist of the key, entries are addresses or CIDR ranges
+func (k *APIKeys) AllowsIP(ip string) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+
+	clientIP := net.ParseIP(ip)
+
+	for _, allowed := range k.AllowedIPs {
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if clientIP != nil && network.Contains(clientIP) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(clientIP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (k *APIKeys) validate() error {
+	if _, err := govalidator.ValidateStruct(k); err != nil {
+		return err
+	}
+
+	for _, allowed := range k.AllowedIPs {
+		if _, _, err := net.ParseCIDR(allowed); err != nil && net.ParseIP(allowed) == nil {
+			return errors.New(allowed + " is neither an IP address nor a CIDR range")
+		}
+	}
+
+	return nil
+}
+
+// validateScopes refuses a key without scopes and scopes no route needs, a typo would grant nothing
+func (k *APIKeys) validateScopes() error {
+	if len(k.Scopes) == 0 {
+		return errors.New("Your key needs at least one scope like incoming-items:read")
+	}
+
+	for _, scope := range k.Scopes {
+		if !KnownAPIKeyScopes[scope] {
+			return errors.New("Unknown scope " + scope + ", scopes are like incoming-items:read or incoming-items:write")
+		}
+	}
+
+	return nil
+}
+
+func (k *APIKeys) BeforeCreate(tx *gorm.DB) (err error) {
+	if err := k.validate(); err != nil {
+		return err
+	}
+
+	return k.validateScopes()
+}
+
+func (k *APIKeys) BeforeUpdate(tx *gorm.DB) (err error) {
+	return k.validate()
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAPIKeyScopesTellReadingFromWriting(t *testing.T) {
+	for route, want := range map[[2]string]string{
+		{http.MethodGet, "/incoming-items/"}:                       "incoming-items:read",
+		{http.MethodGet, "/products/:productId/movements"}:         "products:read",
+		{http.MethodPost, "/incoming-items/"}:                      "incoming-items:write",
+		{http.MethodPut, "/incoming-items/cancel/:incomingItemId"}: "incoming-items:write",
+		{http.MethodDelete, "/products/:productId"}:                "products:write",
+	} {
+		if got := APIKeyScope(route[0], route[1]); got != want {
+			t.Errorf("%s %s needs %s, want %s", route[0], route[1], got, want)
+		}
+	}
+}
+
+func TestAPIKeysNeedKnownScopes(t *testing.T) {
+	KnownAPIKeyScopes = map[string]bool{"incoming-items:read": true, "incoming-items:write": true}
+	defer func() { KnownAPIKeyScopes = map[string]bool{} }()
+
+	for _, scopes := range [][]string{nil, {"incoming-item:read"}, {"incoming-items"}, {"incoming-items:read", "products:write"}} {
+		APIKey := APIKeys{Scopes: scopes}
+
+		if err := APIKey.validateScopes(); err == nil {
+			t.Errorf("a key scoped to %v was accepted", scopes)
+		}
+	}
+
+	APIKey := APIKeys{Scopes: []string{"incoming-items:read"}}
+
+	if err := APIKey.validateScopes(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAuditLogAppendOnly = errors.New("audit logs are append-only")
+
+// audited actions
+const (
+	AuditActionCreate    = "create"
+	AuditActionUpdate    = "update"
+	AuditActionDelete    = "delete"
+	AuditActionArchive   = "archive"
+	AuditActionCancel    = "cancel"
+	AuditActionClose     = "close"
+	AuditActionConfirm   = "confirm"
+	AuditActionReceive   = "receive"
+	AuditActionShip      = "ship"
+	AuditActionDispatch  = "dispatch"
+	AuditActionPost      = "post"
+	AuditActionRegister  = "register"
+	AuditActionRedeliver = "redeliver"
+	AuditActionRevoke    = "revoke"
+	AuditActionLock      = "lock"
+	AuditActionUnlock    = "unlock"
+)
+
+// audited entities
+const (
+	AuditEntityUser            = "user"
+	AuditEntityProduct         = "product"
+	AuditEntityUnitConversion  = "unit_conversion"
+	AuditEntityWarehouse       = "warehouse"
+	AuditEntitySupplier        = "supplier"
+	AuditEntityCustomer        = "customer"
+	AuditEntityPurchaseOrder   = "purchase_order"
+	AuditEntitySalesOrder      = "sales_order"
+	AuditEntityIncomingItem    = "incoming_item"
+	AuditEntityOutgoingItem    = "outgoing_item"
+	AuditEntityTransfer        = "transfer"
+	AuditEntityStockCount      = "stock_count"
+	AuditEntityStockCountEntry = "stock_count_entry"
+	AuditEntityWebhook         = "webhook"
+	AuditEntityWebhookDelivery = "webhook_delivery"
+	AuditEntityAPIKey          = "api_key"
+	AuditEntityLoginIP         = "login_ip"
+)
+
+// AuditLogs record every write, who made it and what the entity looked like before and after.
+// Before is empty for a created entity and After for a deleted one
+type AuditLogs struct {
+	GormModel
+	UserID     *uint     `gorm:"index" json:"user_id"`
+	APIKeyID   *uint     `gorm:"index" json:"api_key_id,omitempty"`
+	Action     string    `gorm:"not null;index" json:"action"`
+	EntityType string    `gorm:"not null;index:idx_audit_logs_entity" json:"entity_type"`
+	EntityID   uint      `gorm:"not null;index:idx_audit_logs_entity" json:"entity_id"`
+	Before     RawJSON   `gorm:"type:jsonb" json:"before"`
+	After      RawJSON   `gorm:"type:jsonb" json:"after"`
+	RequestID  string    `gorm:"index" json:"request_id"`
+	ClientIP   string    `json:"client_ip"`
+	OccurredAt time.Time `gorm:"not null;index" json:"occurred_at"`
+}
+
+func (a *AuditLogs) BeforeUpdate(tx *gorm.DB) (err error) {
+	return ErrAuditLogAppendOnly
+}
+
+func (a *AuditLogs) BeforeDelete(tx *gorm.DB) (err error) {
+	return ErrAuditLogAppendOnly
+}
@@ -0,0 +1,13 @@
+package models
+
+// CostSnapshots keeps the cost state of a product after every source document of its ledger, in the order the
+// documents first moved stock. A change to a document re-costs from the snapshot before it instead of from the
+// first movement of the product
+type CostSnapshots struct {
+	GormModel
+	ProductID       uint    `gorm:"not null;uniqueIndex:idx_cost_snapshots_position" json:"product_id"`
+	FirstMovementID uint    `gorm:"not null;uniqueIndex:idx_cost_snapshots_position" json:"first_movement_id"`
+	SourceType      string  `gorm:"not null" json:"source_type"`
+	SourceID        uint    `gorm:"not null" json:"source_id"`
+	State           RawJSON `gorm:"type:jsonb;not null" json:"state"`
+}
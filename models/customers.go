@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/asaskevich/govalidator"
+	"gorm.io/gorm"
+)
+
+type Customers struct {
+	GormModel
+	Code            string         `gorm:"unique;not null" json:"code" form:"code" valid:"required~Your customer code is required"`
+	Name            string         `gorm:"not null" json:"name" form:"name" valid:"required~Your customer name is required"`
+	ContactName     string         `json:"contact_name" form:"contact_name"`
+	Email           string         `json:"email" form:"email" valid:"email~Invalid email format"`
+	Phone           string         `json:"phone" form:"phone"`
+	ShippingAddress string         `json:"shipping_address" form:"shipping_address"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+func (c *Customers) BeforeCreate(tx *gorm.DB) (err error) {
+	_, errCreate := govalidator.ValidateStruct(c)
+
+	if errCreate != nil {
+		err = errCreate
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (c *Customers) BeforeUpdate(tx *gorm.DB) (err error) {
+	_, errUpdate := govalidator.ValidateStruct(c)
+
+	if errUpdate != nil {
+		err = errUpdate
+		return
+	}
+
+	err = nil
+	return
+}
@@ -1,19 +1,47 @@
 package models
 
 import (
+	"errors"
+	"time"
+
 	"github.com/asaskevich/govalidator"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
 type IncomingItems struct {
 	GormModel
-	Qty        uint8      `gorm:"not null" json:"qty" form:"qty" valid:"required~Your quantity of incoming is required"`
-	IncomingAt CustomTime `gorm:"not null" json:"incoming_at" form:"incoming_at" valid:"required~Your incoming at of incoming is required"`
-	Status     string     `gorm:"not null" json:"status" form:"status" valid:"required"`
-	UserID     uint       `gorm:"not null" json:"user_id" form:"user_id" valid:"required~Your user id is required"`
-	ProductID  uint       `gorm:"not null" json:"product_id" form:"product_id" valid:"required~Your product id is required"`
-	Products   *Products  `gorm:"foreignKey:ProductID;references:ID" json:"products"`
-	Users      *Users     `gorm:"foreignKey:UserID;references:ID" json:"users"`
+	Qty         decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"qty" form:"qty" valid:"required~Your quantity of incoming is required"`
+	Unit        string          `gorm:"not null" json:"unit" form:"unit"`
+	BaseQty     decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"base_qty"`
+	IncomingAt  CustomTime      `gorm:"not null" json:"incoming_at" form:"incoming_at" valid:"required~Your incoming at of incoming is required"`
+	Status      string          `gorm:"not null" json:"status" form:"status" valid:"required"`
+	UserID      uint            `gorm:"not null" json:"user_id" form:"user_id" valid:"required~Your user id is required"`
+	ProductID   uint            `gorm:"not null" json:"product_id" form:"product_id" valid:"required~Your product id is required"`
+	WarehouseID uint            `gorm:"index" json:"warehouse_id" form:"warehouse_id" valid:"required~Your warehouse id is required"`
+	SupplierID  *uint           `gorm:"index" json:"supplier_id" form:"supplier_id"`
+	// SupplierReference is the supplier's delivery note number
+	SupplierReference   string `gorm:"index" json:"supplier_reference" form:"supplier_reference"`
+	PurchaseOrderLineID *uint  `gorm:"index" json:"purchase_order_line_id" form:"purchase_order_line_id"`
+	// UnitCost is the price of one Unit of the item
+	UnitCost   decimal.Decimal `gorm:"type:numeric(20,6);not null;default:0" json:"unit_cost" form:"unit_cost"`
+	LotNumber  string          `gorm:"not null;default:''" json:"lot_number" form:"lot_number"`
+	ExpiryDate *CustomTime     `gorm:"type:date" json:"expiry_date" form:"expiry_date"`
+	// UserID is who booked the item, UpdatedByID and CancelledByID who changed it later, all taken from their tokens
+	UpdatedByID   *uint      `gorm:"index" json:"updated_by_id"`
+	LastUpdatedAt *time.Time `json:"last_updated_at,omitempty"`
+	CancelledByID *uint      `gorm:"index" json:"cancelled_by_id"`
+	CancelledAt   *time.Time `json:"cancelled_at,omitempty"`
+	// Serials names one serial per piece of a serialized product, they are kept in SerialNumbers
+	Serials         []string          `gorm:"-" json:"serials,omitempty" form:"serials"`
+	Products        *Products         `gorm:"foreignKey:ProductID;references:ID" json:"products"`
+	Users           *Users            `gorm:"foreignKey:UserID;references:ID" json:"users"`
+	UpdatedBy       *Users            `gorm:"foreignKey:UpdatedByID;references:ID" json:"updated_by,omitempty"`
+	CancelledBy     *Users            `gorm:"foreignKey:CancelledByID;references:ID" json:"cancelled_by,omitempty"`
+	Warehouses      *Warehouses       `gorm:"foreignKey:WarehouseID;references:ID" json:"warehouses"`
+	Suppliers       *Suppliers        `gorm:"foreignKey:SupplierID;references:ID" json:"suppliers,omitempty"`
+	Movements       []StockMovements  `gorm:"polymorphic:Source;polymorphicValue:incoming_item" json:"movements,omitempty"`
+	SerialMovements []SerialMovements `gorm:"polymorphic:Source;polymorphicValue:incoming_item" json:"serial_movements,omitempty"`
 }
 
 func (p *IncomingItems) BeforeCreate(tx *gorm.DB) (err error) {
@@ -24,6 +52,11 @@ func (p *IncomingItems) BeforeCreate(tx *gorm.DB) (err error) {
 		return
 	}
 
+	if p.UnitCost.IsNegative() {
+		err = errors.New("Your unit cost can't be negative")
+		return
+	}
+
 	err = nil
 	return
 }
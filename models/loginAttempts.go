@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempts count the failed sign-ins of an account or a client IP, the Postgres store of loginguard keeps
+// them here so every instance of the API sees the same count
+type LoginAttempts struct {
+	Key          string     `gorm:"primaryKey" json:"key"`
+	Failures     int        `gorm:"not null;default:0" json:"failures"`
+	LastFailedAt time.Time  `gorm:"not null" json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+}
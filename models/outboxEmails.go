@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+const (
+	OutboxEmailStatusPending = "pending"
+	OutboxEmailStatusSent    = "sent"
+)
+
+// OutboxEmails are mails waiting for whatever sends them, the API itself never talks to a mail server
+type OutboxEmails struct {
+	GormModel
+	Recipient string     `gorm:"not null" json:"recipient"`
+	Subject   string     `gorm:"not null" json:"subject"`
+	Body      string     `gorm:"type:text;not null" json:"body"`
+	Status    string     `gorm:"not null;index;default:pending" json:"status"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OutboxEvents are domain events written in the transaction of the change they describe, the outbox dispatcher
+// publishes them to the registered sinks. Events of one product are published in the order they were written,
+// an event that keeps failing is given up with FailedAt set so the later events of its product go ahead
+type OutboxEvents struct {
+	GormModel
+	EventType     string     `gorm:"not null;index" json:"event_type"`
+	ProductID     uint       `gorm:"not null;index" json:"product_id"`
+	Payload       RawJSON    `gorm:"type:jsonb;not null" json:"payload"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null" json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	PublishedAt   *time.Time `gorm:"index" json:"published_at,omitempty"`
+	FailedAt      *time.Time `gorm:"index" json:"failed_at,omitempty"`
+}
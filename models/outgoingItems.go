@@ -1,19 +1,47 @@
 package models
 
 import (
+	"time"
+
 	"github.com/asaskevich/govalidator"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
 type OutgoingItems struct {
 	GormModel
-	Qty        uint8      `gorm:"not null; numeric" json:"qty" form:"qty" valid:"required~Your quantity of outgoing is required"`
-	OutgoingAt CustomTime `gorm:"not null" json:"outgoing_at" form:"outgoing_at" valid:"required~Your outgoing at of outgoing is required"`
-	Status     string     `gorm:"not null" json:"status" form:"status" valid:"required"`
-	UserID     uint       `gorm:"not null" json:"user_id" form:"user_id" valid:"required~Your user id is required"`
-	ProductID  uint       `gorm:"not null" json:"product_id" form:"product_id" valid:"required~Your product id is required"`
-	Products   *Products  `gorm:"foreignKey:ProductID;references:ID" json:"products"`
-	Users      *Users     `gorm:"foreignKey:UserID;references:ID" json:"users"`
+	Qty              decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"qty" form:"qty" valid:"required~Your quantity of outgoing is required"`
+	Unit             string          `gorm:"not null" json:"unit" form:"unit"`
+	BaseQty          decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"base_qty"`
+	OutgoingAt       CustomTime      `gorm:"not null" json:"outgoing_at" form:"outgoing_at" valid:"required~Your outgoing at of outgoing is required"`
+	Status           string          `gorm:"not null" json:"status" form:"status" valid:"required"`
+	UserID           uint            `gorm:"not null" json:"user_id" form:"user_id" valid:"required~Your user id is required"`
+	ProductID        uint            `gorm:"not null" json:"product_id" form:"product_id" valid:"required~Your product id is required"`
+	WarehouseID      uint            `gorm:"index" json:"warehouse_id" form:"warehouse_id" valid:"required~Your warehouse id is required"`
+	CustomerID       *uint           `gorm:"index" json:"customer_id" form:"customer_id"`
+	SalesOrderLineID *uint           `gorm:"index" json:"sales_order_line_id" form:"sales_order_line_id"`
+	// ShippingAddress is where the item went, copied from the customer unless given
+	ShippingAddress string `json:"shipping_address" form:"shipping_address"`
+	// CostOfGoods is the stock value the item took out under the product's cost method. It's replayed from the ledger
+	// and stored when the item is booked, and again whenever an earlier document or the cost method changes
+	CostOfGoods *decimal.Decimal `gorm:"type:numeric(20,6)" json:"cost_of_goods,omitempty"`
+	// LotNumbers names the lots to issue from in that order, without it lots are issued first-expiry-first-out
+	LotNumbers []string `gorm:"-" json:"lot_numbers,omitempty" form:"lot_numbers"`
+	// UserID is who booked the item, UpdatedByID and CancelledByID who changed it later, all taken from their tokens
+	UpdatedByID   *uint      `gorm:"index" json:"updated_by_id"`
+	LastUpdatedAt *time.Time `json:"last_updated_at,omitempty"`
+	CancelledByID *uint      `gorm:"index" json:"cancelled_by_id"`
+	CancelledAt   *time.Time `json:"cancelled_at,omitempty"`
+	// Serials names one serial per piece of a serialized product, they are kept in SerialNumbers
+	Serials         []string          `gorm:"-" json:"serials,omitempty" form:"serials"`
+	Products        *Products         `gorm:"foreignKey:ProductID;references:ID" json:"products"`
+	Users           *Users            `gorm:"foreignKey:UserID;references:ID" json:"users"`
+	UpdatedBy       *Users            `gorm:"foreignKey:UpdatedByID;references:ID" json:"updated_by,omitempty"`
+	CancelledBy     *Users            `gorm:"foreignKey:CancelledByID;references:ID" json:"cancelled_by,omitempty"`
+	Warehouses      *Warehouses       `gorm:"foreignKey:WarehouseID;references:ID" json:"warehouses"`
+	Customers       *Customers        `gorm:"foreignKey:CustomerID;references:ID" json:"customers,omitempty"`
+	Movements       []StockMovements  `gorm:"polymorphic:Source;polymorphicValue:outgoing_item" json:"movements,omitempty"`
+	SerialMovements []SerialMovements `gorm:"polymorphic:Source;polymorphicValue:outgoing_item" json:"serial_movements,omitempty"`
 }
 
 func (p *OutgoingItems) BeforeCreate(tx *gorm.DB) (err error) {
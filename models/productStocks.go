@@ -0,0 +1,14 @@
+package models
+
+import "github.com/shopspring/decimal"
+
+// ProductStocks holds the balance of a product in one warehouse, Products.Stock is the sum over all warehouses
+type ProductStocks struct {
+	GormModel
+	ProductID   uint             `gorm:"not null;uniqueIndex:idx_product_stocks_product_warehouse" json:"product_id"`
+	WarehouseID uint             `gorm:"not null;uniqueIndex:idx_product_stocks_product_warehouse" json:"warehouse_id"`
+	Stock       decimal.Decimal  `gorm:"type:numeric(20,6);not null;default:0" json:"stock"`
+	Reserved    *decimal.Decimal `gorm:"-" json:"reserved,omitempty"`
+	Available   *decimal.Decimal `gorm:"-" json:"available,omitempty"`
+	Warehouses  *Warehouses      `gorm:"foreignKey:WarehouseID;references:ID" json:"warehouses,omitempty"`
+}
@@ -1,18 +1,126 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"time"
+
 	"github.com/asaskevich/govalidator"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
+// costing methods, both value the stock by replaying the ledger
+const (
+	CostMethodFIFO    = "fifo"
+	CostMethodAverage = "average"
+)
+
 type Products struct {
 	GormModel
-	Name      string         `gorm:"not null" json:"name" form:"name" valid:"required~Your product name is required"`
-	Stock     uint8          `json:"stock" form:"stock"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	Name           string          `gorm:"not null" json:"name" form:"name" valid:"required~Your product name is required"`
+	Stock          decimal.Decimal `gorm:"type:numeric(20,6);not null;default:0" json:"stock" form:"stock"`
+	Unit           string          `gorm:"not null;default:pcs" json:"unit" form:"unit" valid:"in(pcs|kg|m|L)~Your product unit must be one of pcs, kg, m or L"`
+	AllowBackorder bool            `gorm:"not null;default:false" json:"allow_backorder" form:"allow_backorder"`
+	CostMethod     string          `gorm:"not null;default:fifo" json:"cost_method" form:"cost_method" valid:"in(fifo|average)~Your product cost method must be fifo or average"`
+	// Serialized products register one serial number per piece, see SerialNumbers
+	Serialized bool `gorm:"not null;default:false" json:"serialized" form:"serialized"`
+	// stock falling below ReorderPoint raises a low-stock alert, ReorderQty is what is usually ordered then
+	// and SafetyStock is the buffer that should never be touched. A zero ReorderPoint turns alerts off
+	ReorderPoint decimal.Decimal `gorm:"type:numeric(20,6);not null;default:0" json:"reorder_point" form:"reorder_point"`
+	SafetyStock  decimal.Decimal `gorm:"type:numeric(20,6);not null;default:0" json:"safety_stock" form:"safety_stock"`
+	ReorderQty   decimal.Decimal `gorm:"type:numeric(20,6);not null;default:0" json:"reorder_qty" form:"reorder_qty"`
+	DeletedAt    gorm.DeletedAt  `gorm:"index" json:"deleted_at,omitempty"`
+	Stocks       []ProductStocks `gorm:"foreignKey:ProductID;references:ID" json:"stocks,omitempty"`
+	// Reserved is what confirmed sales orders haven't shipped yet, Available is Stock less Reserved
+	Reserved  *decimal.Decimal `gorm:"-" json:"reserved,omitempty"`
+	Available *decimal.Decimal `gorm:"-" json:"available,omitempty"`
+	// InTransit is only filled for a single product, it is the quantity dispatched but not yet received
+	InTransit *decimal.Decimal `gorm:"-" json:"in_transit,omitempty"`
+	// WarehouseID only names the warehouse the opening stock of a new product is booked in, it isn't stored
+	WarehouseID uint `gorm:"-" json:"warehouse_id,omitempty" form:"warehouse_id"`
+}
+
+// ProductResponse is a product as every response shows it, the fields only used to create one stay inside
+type ProductResponse struct {
+	ID             uint             `json:"id"`
+	Name           string           `json:"name"`
+	Stock          decimal.Decimal  `json:"stock"`
+	Unit           string           `json:"unit"`
+	AllowBackorder bool             `json:"allow_backorder"`
+	CostMethod     string           `json:"cost_method"`
+	Serialized     bool             `json:"serialized"`
+	ReorderPoint   decimal.Decimal  `json:"reorder_point"`
+	SafetyStock    decimal.Decimal  `json:"safety_stock"`
+	ReorderQty     decimal.Decimal  `json:"reorder_qty"`
+	Stocks         []ProductStocks  `json:"stocks,omitempty"`
+	Reserved       *decimal.Decimal `json:"reserved,omitempty"`
+	Available      *decimal.Decimal `json:"available,omitempty"`
+	InTransit      *decimal.Decimal `json:"in_transit,omitempty"`
+	CreatedAt      *time.Time       `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time       `json:"updated_at,omitempty"`
+	DeletedAt      *time.Time       `json:"deleted_at,omitempty"`
+}
+
+func (p Products) Response() ProductResponse {
+	Response := ProductResponse{
+		ID:             p.ID,
+		Name:           p.Name,
+		Stock:          p.Stock,
+		Unit:           p.Unit,
+		AllowBackorder: p.AllowBackorder,
+		CostMethod:     p.CostMethod,
+		Serialized:     p.Serialized,
+		ReorderPoint:   p.ReorderPoint,
+		SafetyStock:    p.SafetyStock,
+		ReorderQty:     p.ReorderQty,
+		Stocks:         p.Stocks,
+		Reserved:       p.Reserved,
+		Available:      p.Available,
+		InTransit:      p.InTransit,
+		CreatedAt:      p.CreatedAt,
+		UpdatedAt:      p.UpdatedAt,
+	}
+
+	if p.DeletedAt.Valid {
+		Response.DeletedAt = &p.DeletedAt.Time
+	}
+
+	return Response
+}
+
+// MarshalJSON answers Response wherever a product ends up in JSON, on its own or preloaded into an item
+func (p Products) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Response())
+}
+
+// IsBelowReorderPoint tells whether stock calls for reordering the product
+func (p *Products) IsBelowReorderPoint(stock decimal.Decimal) bool {
+	return p.ReorderPoint.IsPositive() && stock.LessThan(p.ReorderPoint)
+}
+
+func (p *Products) validateReorder() error {
+	if p.ReorderPoint.IsNegative() || p.SafetyStock.IsNegative() || p.ReorderQty.IsNegative() {
+		return errors.New("Your reorder point, safety stock and reorder quantity can't be negative")
+	}
+
+	return nil
+}
+
+// IsWholeQty tells whether qty is valid in the product's base unit, pieces can't be split
+func (p *Products) IsWholeQty(qty decimal.Decimal) bool {
+	return p.Unit != UnitPieces || qty.IsInteger()
 }
 
 func (p *Products) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.Unit == "" {
+		p.Unit = UnitPieces
+	}
+
+	if p.CostMethod == "" {
+		p.CostMethod = CostMethodFIFO
+	}
+
 	_, errCreate := govalidator.ValidateStruct(p)
 
 	if errCreate != nil {
@@ -20,6 +128,15 @@ func (p *Products) BeforeCreate(tx *gorm.DB) (err error) {
 		return
 	}
 
+	if p.Serialized && p.Unit != UnitPieces {
+		err = errors.New("Serialized products must be stocked in pcs")
+		return
+	}
+
+	if err = p.validateReorder(); err != nil {
+		return
+	}
+
 	err = nil
 	return
 }
@@ -32,6 +149,10 @@ func (p *Products) BeforeUpdate(tx *gorm.DB) (err error) {
 		return
 	}
 
+	if err = p.validateReorder(); err != nil {
+		return
+	}
+
 	err = nil
 	return
 
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	PurchaseOrderStatusOpen              = "open"
+	PurchaseOrderStatusPartiallyReceived = "partially_received"
+	PurchaseOrderStatusClosed            = "closed"
+	PurchaseOrderStatusCancelled         = "cancelled"
+)
+
+// PurchaseOrders are goods ordered from a supplier, they arrive as incoming items against the lines.
+// A line may receive up to TolerancePercent more than ordered, ShortClosed orders were closed before everything arrived
+type PurchaseOrders struct {
+	GormModel
+	SupplierID       uint                 `gorm:"not null;index" json:"supplier_id" form:"supplier_id" valid:"required~Your supplier id is required"`
+	Status           string               `gorm:"not null;index" json:"status" form:"status" valid:"required"`
+	Note             string               `json:"note" form:"note"`
+	TolerancePercent decimal.Decimal      `gorm:"type:numeric(9,4);not null;default:0" json:"tolerance_percent" form:"tolerance_percent"`
+	UserID           uint                 `gorm:"not null" json:"user_id"`
+	OrderedAt        time.Time            `gorm:"not null" json:"ordered_at"`
+	ShortClosed      bool                 `gorm:"not null;default:false" json:"short_closed"`
+	ClosedAt         *time.Time           `json:"closed_at,omitempty"`
+	CancelledAt      *time.Time           `json:"cancelled_at,omitempty"`
+	Lines            []PurchaseOrderLines `gorm:"foreignKey:PurchaseOrderID;references:ID" json:"lines"`
+	Suppliers        *Suppliers           `gorm:"foreignKey:SupplierID;references:ID" json:"suppliers,omitempty"`
+	Users            *Users               `gorm:"foreignKey:UserID;references:ID" json:"users,omitempty"`
+}
+
+// PurchaseOrderLines hold the ordered quantity in Unit and in the product's base unit, ReceivedQty is in the base unit
+type PurchaseOrderLines struct {
+	GormModel
+	PurchaseOrderID uint            `gorm:"not null;index" json:"purchase_order_id"`
+	ProductID       uint            `gorm:"not null" json:"product_id" valid:"required~Your product id is required"`
+	Qty             decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"qty" valid:"required~Your quantity of order is required"`
+	Unit            string          `gorm:"not null" json:"unit"`
+	BaseQty         decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"base_qty"`
+	ReceivedQty     decimal.Decimal `gorm:"type:numeric(20,6);not null;default:0" json:"received_qty"`
+	UnitCost        decimal.Decimal `gorm:"type:numeric(20,6);not null;default:0" json:"unit_cost"`
+	ExpectedAt      *CustomTime     `gorm:"type:date" json:"expected_at"`
+	// OutstandingQty is what is still to arrive, it's only filled when the order is read
+	OutstandingQty *decimal.Decimal `gorm:"-" json:"outstanding_qty,omitempty"`
+	Products       *Products        `gorm:"foreignKey:ProductID;references:ID" json:"products,omitempty"`
+	IncomingItems  []IncomingItems  `gorm:"foreignKey:PurchaseOrderLineID;references:ID" json:"incoming_items,omitempty"`
+}
+
+func (p *PurchaseOrders) BeforeCreate(tx *gorm.DB) (err error) {
+	_, errCreate := govalidator.ValidateStruct(p)
+
+	if errCreate != nil {
+		err = errCreate
+		return
+	}
+
+	if p.TolerancePercent.IsNegative() {
+		err = errors.New("Your tolerance percent can't be negative")
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (p *PurchaseOrders) BeforeUpdate(tx *gorm.DB) (err error) {
+	_, errUpdate := govalidator.ValidateStruct(p)
+
+	if errUpdate != nil {
+		err = errUpdate
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (l *PurchaseOrderLines) BeforeCreate(tx *gorm.DB) (err error) {
+	if l.UnitCost.IsNegative() {
+		err = errors.New("Your unit cost can't be negative")
+		return
+	}
+
+	err = nil
+	return
+}
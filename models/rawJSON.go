@@ -0,0 +1,46 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// RawJSON is a JSON document stored as jsonb and answered as JSON, not as a string
+type RawJSON []byte
+
+func (rj RawJSON) MarshalJSON() ([]byte, error) {
+	if len(rj) == 0 {
+		return []byte("null"), nil
+	}
+
+	return rj, nil
+}
+
+func (rj *RawJSON) UnmarshalJSON(b []byte) error {
+	*rj = append((*rj)[0:0], b...)
+
+	return nil
+}
+
+func (rj RawJSON) Value() (driver.Value, error) {
+	if len(rj) == 0 {
+		return nil, nil
+	}
+
+	return string(rj), nil
+}
+
+func (rj *RawJSON) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*rj = nil
+	case []byte:
+		*rj = append(RawJSON{}, v...)
+	case string:
+		*rj = RawJSON(v)
+	default:
+		return fmt.Errorf("cannot convert %v to RawJSON", value)
+	}
+
+	return nil
+}
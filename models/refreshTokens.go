@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// RefreshTokens are kept as hashes, every refresh uses one up and issues the next of the same family.
+// A used or revoked token coming back means it leaked, and the whole family is revoked
+type RefreshTokens struct {
+	GormModel
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	FamilyID  string     `gorm:"not null;index" json:"family_id"`
+	TokenHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// RevokedTokens deny access tokens signed out before they expire, a row is only needed until ExpiresAt
+type RevokedTokens struct {
+	JTI       string    `gorm:"primaryKey" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestPreloadedUsersNeverShowTheirPassword(t *testing.T) {
+	User := &Users{Username: "someone", Email: "someone@example.com", Password: "$2a$08$hash", Role: RoleClerk}
+	Product := &Products{Name: "Widget", Stock: decimal.NewFromInt(3)}
+	productID := uint(1)
+
+	for name, value := range map[string]interface{}{
+		"user":          User,
+		"movement":      StockMovements{ProductID: productID, Users: User, Products: Product},
+		"outgoing item": OutgoingItems{Users: User, Products: Product, Movements: []StockMovements{{Users: User}}},
+		"incoming item": IncomingItems{Users: User, Products: Product, Movements: []StockMovements{{Users: User}}},
+	} {
+		body, err := json.Marshal(value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(body), `"password"`) || strings.Contains(string(body), User.Password) {
+			t.Errorf("the %s shows a password: %s", name, body)
+		}
+	}
+}
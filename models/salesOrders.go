@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	SalesOrderStatusDraft            = "draft"
+	SalesOrderStatusConfirmed        = "confirmed"
+	SalesOrderStatusPartiallyShipped = "partially_shipped"
+	SalesOrderStatusShipped          = "shipped"
+	SalesOrderStatusCancelled        = "cancelled"
+)
+
+// SalesOrderReservingStatuses are the statuses in which an order holds on to what it hasn't shipped yet
+var SalesOrderReservingStatuses = []string{SalesOrderStatusConfirmed, SalesOrderStatusPartiallyShipped}
+
+// SalesOrders promise stock of WarehouseID to a customer, confirmation reserves the lines and
+// they are shipped as outgoing items
+type SalesOrders struct {
+	GormModel
+	CustomerID  uint              `gorm:"not null;index" json:"customer_id" form:"customer_id" valid:"required~Your customer id is required"`
+	WarehouseID uint              `gorm:"not null;index" json:"warehouse_id" form:"warehouse_id" valid:"required~Your warehouse id is required"`
+	Status      string            `gorm:"not null;index" json:"status" form:"status" valid:"required"`
+	Note        string            `json:"note" form:"note"`
+	UserID      uint              `gorm:"not null" json:"user_id"`
+	ConfirmedAt *time.Time        `json:"confirmed_at,omitempty"`
+	ShippedAt   *time.Time        `json:"shipped_at,omitempty"`
+	CancelledAt *time.Time        `json:"cancelled_at,omitempty"`
+	Lines       []SalesOrderLines `gorm:"foreignKey:SalesOrderID;references:ID" json:"lines"`
+	Customers   *Customers        `gorm:"foreignKey:CustomerID;references:ID" json:"customers,omitempty"`
+	Warehouses  *Warehouses       `gorm:"foreignKey:WarehouseID;references:ID" json:"warehouses,omitempty"`
+	Users       *Users            `gorm:"foreignKey:UserID;references:ID" json:"users,omitempty"`
+}
+
+// SalesOrderLines hold the ordered quantity in Unit and in the product's base unit, ShippedQty is in the base unit.
+// While the order reserves, BaseQty - ShippedQty of the product is reserved
+type SalesOrderLines struct {
+	GormModel
+	SalesOrderID  uint            `gorm:"not null;index" json:"sales_order_id"`
+	ProductID     uint            `gorm:"not null;index" json:"product_id" valid:"required~Your product id is required"`
+	Qty           decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"qty" valid:"required~Your quantity of order is required"`
+	Unit          string          `gorm:"not null" json:"unit"`
+	BaseQty       decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"base_qty"`
+	ShippedQty    decimal.Decimal `gorm:"type:numeric(20,6);not null;default:0" json:"shipped_qty"`
+	Products      *Products       `gorm:"foreignKey:ProductID;references:ID" json:"products,omitempty"`
+	OutgoingItems []OutgoingItems `gorm:"foreignKey:SalesOrderLineID;references:ID" json:"outgoing_items,omitempty"`
+}
+
+func (s *SalesOrders) BeforeCreate(tx *gorm.DB) (err error) {
+	_, errCreate := govalidator.ValidateStruct(s)
+
+	if errCreate != nil {
+		err = errCreate
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (s *SalesOrders) BeforeUpdate(tx *gorm.DB) (err error) {
+	_, errUpdate := govalidator.ValidateStruct(s)
+
+	if errUpdate != nil {
+		err = errUpdate
+		return
+	}
+
+	err = nil
+	return
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SerialStatusInStock = "in_stock"
+	SerialStatusIssued  = "issued"
+	// SerialStatusVoid is a serial whose receipt was cancelled, it can be received again
+	SerialStatusVoid = "void"
+
+	MovementActionIssued = "issued"
+)
+
+var ErrSerialMovementAppendOnly = errors.New("serial movements are append-only")
+
+// SerialNumbers is a single piece of a serialized product, StockLotID is the lot it was received into
+type SerialNumbers struct {
+	GormModel
+	ProductID   uint              `gorm:"not null;index" json:"product_id"`
+	Serial      string            `gorm:"not null;uniqueIndex" json:"serial"`
+	WarehouseID uint              `gorm:"not null;index" json:"warehouse_id"`
+	StockLotID  uint              `gorm:"not null" json:"stock_lot_id"`
+	Status      string            `gorm:"not null" json:"status"`
+	Products    *Products         `gorm:"foreignKey:ProductID;references:ID" json:"products,omitempty"`
+	Warehouses  *Warehouses       `gorm:"foreignKey:WarehouseID;references:ID" json:"warehouses,omitempty"`
+	StockLots   *StockLots        `gorm:"foreignKey:StockLotID;references:ID" json:"stock_lots,omitempty"`
+	Movements   []SerialMovements `gorm:"foreignKey:SerialNumberID;references:ID" json:"movements,omitempty"`
+}
+
+// SerialMovements is the history of a serial number, one row per document that received, issued or cancelled it
+type SerialMovements struct {
+	GormModel
+	SerialNumberID uint           `gorm:"not null;index" json:"serial_number_id"`
+	WarehouseID    uint           `gorm:"not null" json:"warehouse_id"`
+	SourceType     string         `gorm:"not null;index:idx_serial_movements_source" json:"source_type"`
+	SourceID       uint           `gorm:"not null;index:idx_serial_movements_source" json:"source_id"`
+	Action         string         `gorm:"not null" json:"action"`
+	UserID         uint           `json:"user_id"`
+	MovedAt        time.Time      `gorm:"not null" json:"moved_at"`
+	SerialNumbers  *SerialNumbers `gorm:"foreignKey:SerialNumberID;references:ID" json:"serial_numbers,omitempty"`
+	Users          *Users         `gorm:"foreignKey:UserID;references:ID" json:"users,omitempty"`
+	Warehouses     *Warehouses    `gorm:"foreignKey:WarehouseID;references:ID" json:"warehouses,omitempty"`
+}
+
+func (m *SerialMovements) BeforeUpdate(tx *gorm.DB) (err error) {
+	return ErrSerialMovementAppendOnly
+}
+
+func (m *SerialMovements) BeforeDelete(tx *gorm.DB) (err error) {
+	return ErrSerialMovementAppendOnly
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	StockCountStatusOpen      = "open"
+	StockCountStatusPosted    = "posted"
+	StockCountStatusCancelled = "cancelled"
+
+	MovementSourceStockCount = "stock_count"
+)
+
+// reason codes an adjustment movement from a stock count can carry
+const (
+	ReasonCountVariance  = "count_variance"
+	ReasonDamaged        = "damaged"
+	ReasonExpired        = "expired"
+	ReasonLost           = "lost"
+	ReasonFound          = "found"
+	ReasonDataEntryError = "data_entry_error"
+)
+
+var ReasonCodes = []string{ReasonCountVariance, ReasonDamaged, ReasonExpired, ReasonLost, ReasonFound, ReasonDataEntryError}
+
+func IsReasonCode(code string) bool {
+	for _, reasonCode := range ReasonCodes {
+		if reasonCode == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StockCounts is a physical count session of one warehouse, the system stock of every line is frozen when it starts
+type StockCounts struct {
+	GormModel
+	WarehouseID uint              `gorm:"not null;index" json:"warehouse_id" valid:"required~Your warehouse id is required"`
+	Status      string            `gorm:"not null;index" json:"status" valid:"required"`
+	Note        string            `json:"note"`
+	UserID      uint              `gorm:"not null" json:"user_id"`
+	StartedAt   time.Time         `gorm:"not null" json:"started_at"`
+	PostedAt    *time.Time        `json:"posted_at,omitempty"`
+	CancelledAt *time.Time        `json:"cancelled_at,omitempty"`
+	Lines       []StockCountLines `gorm:"foreignKey:StockCountID;references:ID" json:"lines"`
+	Warehouses  *Warehouses       `gorm:"foreignKey:WarehouseID;references:ID" json:"warehouses,omitempty"`
+	Users       *Users            `gorm:"foreignKey:UserID;references:ID" json:"users,omitempty"`
+}
+
+type StockCountLines struct {
+	GormModel
+	StockCountID uint                `gorm:"not null;uniqueIndex:idx_stock_count_lines_count_product" json:"stock_count_id"`
+	ProductID    uint                `gorm:"not null;uniqueIndex:idx_stock_count_lines_count_product" json:"product_id"`
+	FrozenQty    decimal.Decimal     `gorm:"type:numeric(20,6);not null" json:"frozen_qty"`
+	CountedQty   *decimal.Decimal    `gorm:"type:numeric(20,6)" json:"counted_qty"`
+	CountedAt    *time.Time          `json:"counted_at,omitempty"`
+	VarianceQty  *decimal.Decimal    `gorm:"type:numeric(20,6)" json:"variance_qty"`
+	ReasonCode   string              `json:"reason_code,omitempty"`
+	Entries      []StockCountEntries `gorm:"foreignKey:StockCountLineID;references:ID" json:"entries,omitempty"`
+	Products     *Products           `gorm:"foreignKey:ProductID;references:ID" json:"products,omitempty"`
+}
+
+// StockCountEntries are the quantities entered by the counters, a line is counted as the sum of its entries
+type StockCountEntries struct {
+	GormModel
+	StockCountLineID uint            `gorm:"not null;index" json:"stock_count_line_id"`
+	UserID           uint            `gorm:"not null" json:"user_id"`
+	Qty              decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"qty"`
+	Unit             string          `gorm:"not null" json:"unit"`
+	BaseQty          decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"base_qty"`
+	CountedAt        time.Time       `gorm:"not null" json:"counted_at"`
+	Users            *Users          `gorm:"foreignKey:UserID;references:ID" json:"users,omitempty"`
+}
+
+func (s *StockCounts) BeforeCreate(tx *gorm.DB) (err error) {
+	_, errCreate := govalidator.ValidateStruct(s)
+
+	if errCreate != nil {
+		err = errCreate
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (s *StockCounts) BeforeUpdate(tx *gorm.DB) (err error) {
+	_, errUpdate := govalidator.ValidateStruct(s)
+
+	if errUpdate != nil {
+		err = errUpdate
+		return
+	}
+
+	err = nil
+	return
+}
@@ -0,0 +1,16 @@
+package models
+
+import "github.com/shopspring/decimal"
+
+// StockLots holds the balance of one lot of a product in a warehouse, the lots of a product in a warehouse
+// add up to its ProductStocks balance. Stock received without a lot number lives in the lot with an empty number
+type StockLots struct {
+	GormModel
+	ProductID   uint            `gorm:"not null;uniqueIndex:idx_stock_lots_product_warehouse_lot" json:"product_id"`
+	WarehouseID uint            `gorm:"not null;uniqueIndex:idx_stock_lots_product_warehouse_lot" json:"warehouse_id"`
+	LotNumber   string          `gorm:"not null;default:'';uniqueIndex:idx_stock_lots_product_warehouse_lot" json:"lot_number"`
+	ExpiryDate  *CustomTime     `gorm:"type:date;index" json:"expiry_date"`
+	Stock       decimal.Decimal `gorm:"type:numeric(20,6);not null;default:0" json:"stock"`
+	Products    *Products       `gorm:"foreignKey:ProductID;references:ID" json:"products,omitempty"`
+	Warehouses  *Warehouses     `gorm:"foreignKey:WarehouseID;references:ID" json:"warehouses,omitempty"`
+}
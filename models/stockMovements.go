@@ -0,0 +1,119 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"inventoryapp/helpers"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	MovementSourceIncomingItem = "incoming_item"
+	MovementSourceOutgoingItem = "outgoing_item"
+	MovementSourceProduct      = "product"
+
+	MovementActionCreated   = "created"
+	MovementActionUpdated   = "updated"
+	MovementActionCancelled = "cancelled"
+	MovementActionAdjusted  = "adjusted"
+
+	// ReasonOpeningBalance marks the movement that brings stock recorded before the ledger existed into it
+	ReasonOpeningBalance = "opening_balance"
+)
+
+var ErrStockMovementAppendOnly = errors.New("stock movements are append-only")
+
+// StockMovements is the ledger behind Products.Stock, every change of stock writes one signed row here
+// with the quantity normalized to the product's base unit
+type StockMovements struct {
+	GormModel
+	ProductID    uint            `gorm:"not null;index" json:"product_id"`
+	WarehouseID  uint            `gorm:"index" json:"warehouse_id"`
+	StockLotID   uint            `gorm:"index" json:"stock_lot_id"`
+	Qty          decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"qty"`
+	BalanceAfter decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"balance_after"`
+	// WarehouseBalanceAfter is the balance of the product in WarehouseID, BalanceAfter is the product total
+	WarehouseBalanceAfter decimal.Decimal `gorm:"type:numeric(20,6);not null;default:0" json:"warehouse_balance_after"`
+	SourceType            string          `gorm:"not null;index:idx_stock_movements_source" json:"source_type"`
+	SourceID              uint            `gorm:"not null;index:idx_stock_movements_source" json:"source_id"`
+	Action                string          `gorm:"not null" json:"action"`
+	ReasonCode            string          `json:"reason_code,omitempty"`
+	UserID                uint            `json:"user_id"`
+	MovedAt               time.Time       `gorm:"not null" json:"moved_at"`
+	Products              *Products       `gorm:"foreignKey:ProductID;references:ID" json:"products,omitempty"`
+	Users                 *Users          `gorm:"foreignKey:UserID;references:ID" json:"users,omitempty"`
+	Warehouses            *Warehouses     `gorm:"foreignKey:WarehouseID;references:ID" json:"warehouses,omitempty"`
+	StockLots             *StockLots      `gorm:"foreignKey:StockLotID;references:ID" json:"stock_lots,omitempty"`
+}
+
+// StockMovementResponse is a movement as every response shows it, the user who moved the stock only with
+// what any user is shown of them
+type StockMovementResponse struct {
+	ID                    uint                  `json:"id"`
+	ProductID             uint                  `json:"product_id"`
+	WarehouseID           uint                  `json:"warehouse_id"`
+	StockLotID            uint                  `json:"stock_lot_id"`
+	Qty                   decimal.Decimal       `json:"qty"`
+	BalanceAfter          decimal.Decimal       `json:"balance_after"`
+	WarehouseBalanceAfter decimal.Decimal       `json:"warehouse_balance_after"`
+	SourceType            string                `json:"source_type"`
+	SourceID              uint                  `json:"source_id"`
+	Action                string                `json:"action"`
+	ReasonCode            string                `json:"reason_code,omitempty"`
+	UserID                uint                  `json:"user_id"`
+	MovedAt               time.Time             `json:"moved_at"`
+	CreatedAt             *time.Time            `json:"created_at,omitempty"`
+	Products              *ProductResponse      `json:"products,omitempty"`
+	Users                 *helpers.UserResponse `json:"users,omitempty"`
+	Warehouses            *Warehouses           `json:"warehouses,omitempty"`
+	StockLots             *StockLots            `json:"stock_lots,omitempty"`
+}
+
+func (m StockMovements) Response() StockMovementResponse {
+	Response := StockMovementResponse{
+		ID:                    m.ID,
+		ProductID:             m.ProductID,
+		WarehouseID:           m.WarehouseID,
+		StockLotID:            m.StockLotID,
+		Qty:                   m.Qty,
+		BalanceAfter:          m.BalanceAfter,
+		WarehouseBalanceAfter: m.WarehouseBalanceAfter,
+		SourceType:            m.SourceType,
+		SourceID:              m.SourceID,
+		Action:                m.Action,
+		ReasonCode:            m.ReasonCode,
+		UserID:                m.UserID,
+		MovedAt:               m.MovedAt,
+		CreatedAt:             m.CreatedAt,
+		Warehouses:            m.Warehouses,
+		StockLots:             m.StockLots,
+	}
+
+	if m.Products != nil {
+		Product := m.Products.Response()
+		Response.Products = &Product
+	}
+
+	if m.Users != nil {
+		User := m.Users.Response()
+		Response.Users = &User
+	}
+
+	return Response
+}
+
+// MarshalJSON answers Response wherever a movement ends up in JSON, listed for a product or preloaded into an item
+func (m StockMovements) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Response())
+}
+
+func (m *StockMovements) BeforeUpdate(tx *gorm.DB) (err error) {
+	return ErrStockMovementAppendOnly
+}
+
+func (m *StockMovements) BeforeDelete(tx *gorm.DB) (err error) {
+	return ErrStockMovementAppendOnly
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/asaskevich/govalidator"
+	"gorm.io/gorm"
+)
+
+type Suppliers struct {
+	GormModel
+	Code        string         `gorm:"unique;not null" json:"code" form:"code" valid:"required~Your supplier code is required"`
+	Name        string         `gorm:"not null" json:"name" form:"name" valid:"required~Your supplier name is required"`
+	ContactName string         `json:"contact_name" form:"contact_name"`
+	Email       string         `json:"email" form:"email" valid:"email~Invalid email format"`
+	Phone       string         `json:"phone" form:"phone"`
+	Address     string         `json:"address" form:"address"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+func (s *Suppliers) BeforeCreate(tx *gorm.DB) (err error) {
+	_, errCreate := govalidator.ValidateStruct(s)
+
+	if errCreate != nil {
+		err = errCreate
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (s *Suppliers) BeforeUpdate(tx *gorm.DB) (err error) {
+	_, errUpdate := govalidator.ValidateStruct(s)
+
+	if errUpdate != nil {
+		err = errUpdate
+		return
+	}
+
+	err = nil
+	return
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	TransferStatusDraft     = "draft"
+	TransferStatusInTransit = "in_transit"
+	TransferStatusReceived  = "received"
+	TransferStatusCancelled = "cancelled"
+
+	MovementSourceTransfer = "transfer"
+
+	MovementActionDispatched = "dispatched"
+	MovementActionReceived   = "received"
+)
+
+// Transfers moves stock between two warehouses, dispatch takes it out of the source and
+// receipt puts it into the destination, in between the quantity is in transit
+type Transfers struct {
+	GormModel
+	SourceWarehouseID      uint            `gorm:"not null;index" json:"source_warehouse_id" form:"source_warehouse_id" valid:"required~Your source warehouse id is required"`
+	DestinationWarehouseID uint            `gorm:"not null;index" json:"destination_warehouse_id" form:"destination_warehouse_id" valid:"required~Your destination warehouse id is required"`
+	Status                 string          `gorm:"not null;index" json:"status" form:"status" valid:"required"`
+	Note                   string          `json:"note" form:"note"`
+	UserID                 uint            `gorm:"not null" json:"user_id"`
+	DispatchedAt           *time.Time      `json:"dispatched_at,omitempty"`
+	ReceivedAt             *time.Time      `json:"received_at,omitempty"`
+	CancelledAt            *time.Time      `json:"cancelled_at,omitempty"`
+	Lines                  []TransferLines `gorm:"foreignKey:TransferID;references:ID" json:"lines"`
+	SourceWarehouses       *Warehouses     `gorm:"foreignKey:SourceWarehouseID;references:ID" json:"source_warehouses,omitempty"`
+	DestinationWarehouses  *Warehouses     `gorm:"foreignKey:DestinationWarehouseID;references:ID" json:"destination_warehouses,omitempty"`
+	Users                  *Users          `gorm:"foreignKey:UserID;references:ID" json:"users,omitempty"`
+}
+
+type TransferLines struct {
+	GormModel
+	TransferID uint            `gorm:"not null;index" json:"transfer_id"`
+	ProductID  uint            `gorm:"not null" json:"product_id" valid:"required~Your product id is required"`
+	Qty        decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"qty" valid:"required~Your quantity of transfer is required"`
+	Unit       string          `gorm:"not null" json:"unit"`
+	BaseQty    decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"base_qty"`
+	Products   *Products       `gorm:"foreignKey:ProductID;references:ID" json:"products,omitempty"`
+}
+
+func (t *Transfers) BeforeCreate(tx *gorm.DB) (err error) {
+	_, errCreate := govalidator.ValidateStruct(t)
+
+	if errCreate != nil {
+		err = errCreate
+		return
+	}
+
+	if t.SourceWarehouseID == t.DestinationWarehouseID {
+		err = errors.New("Your source and destination warehouse must differ")
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (t *Transfers) BeforeUpdate(tx *gorm.DB) (err error) {
+	_, errUpdate := govalidator.ValidateStruct(t)
+
+	if errUpdate != nil {
+		err = errUpdate
+		return
+	}
+
+	if t.SourceWarehouseID == t.DestinationWarehouseID {
+		err = errors.New("Your source and destination warehouse must differ")
+		return
+	}
+
+	err = nil
+	return
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// base units of measure a product can be stocked in
+const (
+	UnitPieces   = "pcs"
+	UnitKilogram = "kg"
+	UnitMeter    = "m"
+	UnitLiter    = "L"
+)
+
+// UnitConversions defines how many base units of a product one alternate unit holds, e.g. 1 box = 24 pcs
+type UnitConversions struct {
+	GormModel
+	ProductID uint            `gorm:"not null;uniqueIndex:idx_unit_conversions_product_unit" json:"product_id"`
+	Unit      string          `gorm:"not null;uniqueIndex:idx_unit_conversions_product_unit" json:"unit" form:"unit" valid:"required~Your unit name is required"`
+	Factor    decimal.Decimal `gorm:"type:numeric(20,6);not null" json:"factor" form:"factor" valid:"required~Your unit factor is required"`
+	Products  *Products       `gorm:"foreignKey:ProductID;references:ID" json:"products,omitempty"`
+}
+
+func (u *UnitConversions) BeforeCreate(tx *gorm.DB) (err error) {
+	_, errCreate := govalidator.ValidateStruct(u)
+
+	if errCreate != nil {
+		err = errCreate
+		return
+	}
+
+	if !u.Factor.IsPositive() {
+		err = errors.New("Your unit factor must be greater than zero")
+		return
+	}
+
+	err = nil
+	return
+}
@@ -1,17 +1,61 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
 	"inventoryapp/helpers"
 
 	"github.com/asaskevich/govalidator"
 	"gorm.io/gorm"
 )
 
+// roles of a user, from most to least privileged
+const (
+	RoleAdmin            = "admin"
+	RoleWarehouseManager = "warehouse_manager"
+	RoleClerk            = "clerk"
+	RoleViewer           = "viewer"
+)
+
+var UserRoles = []string{RoleAdmin, RoleWarehouseManager, RoleClerk, RoleViewer}
+
 type Users struct {
 	GormModel
 	Username string `gorm:"unique;not null;uniqueIndex" json:"username" form:"username" valid:"required~Your username is required"`
 	Email    string `gorm:"unique;not null;uniqueIndex" json:"email" form:"email" valid:"required~Your email is required"`
 	Password string `gorm:"not null" json:"password" form:"password" valid:"required~Your password is required,minstringlength(6)~Your password must be at least 6 characters"`
+	Role     string `gorm:"not null;default:viewer" json:"role" form:"role"`
+	// service accounts only authenticate with API keys, never with their password
+	ServiceAccount bool `gorm:"not null;default:false" json:"service_account"`
+}
+
+// Response is the user without its password hash
+func (u Users) Response() helpers.UserResponse {
+	return helpers.UserResponse{
+		ID:             u.ID,
+		Username:       u.Username,
+		Email:          u.Email,
+		Role:           u.Role,
+		ServiceAccount: u.ServiceAccount,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
+	}
+}
+
+// MarshalJSON answers Response wherever a user ends up in JSON, preloaded into a movement or an audit snapshot
+// alike, so the password hash never leaves the database. Binding a request still reads the password
+func (u Users) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.Response())
+}
+
+func IsUserRole(role string) bool {
+	for _, userRole := range UserRoles {
+		if role == userRole {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (u *Users) BeforeCreate(tx *gorm.DB) (err error) {
@@ -22,6 +66,11 @@ func (u *Users) BeforeCreate(tx *gorm.DB) (err error) {
 		return
 	}
 
+	if u.Role != "" && !IsUserRole(u.Role) {
+		err = errors.New("Unknown role " + u.Role)
+		return
+	}
+
 	u.Password = helpers.HashPass(u.Password)
 	err = nil
 	return
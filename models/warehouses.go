@@ -0,0 +1,38 @@
+package models
+
+import (
+	"github.com/asaskevich/govalidator"
+	"gorm.io/gorm"
+)
+
+type Warehouses struct {
+	GormModel
+	Code      string         `gorm:"unique;not null" json:"code" form:"code" valid:"required~Your warehouse code is required"`
+	Name      string         `gorm:"not null" json:"name" form:"name" valid:"required~Your warehouse name is required"`
+	Address   string         `json:"address" form:"address"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+func (w *Warehouses) BeforeCreate(tx *gorm.DB) (err error) {
+	_, errCreate := govalidator.ValidateStruct(w)
+
+	if errCreate != nil {
+		err = errCreate
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (w *Warehouses) BeforeUpdate(tx *gorm.DB) (err error) {
+	_, errUpdate := govalidator.ValidateStruct(w)
+
+	if errUpdate != nil {
+		err = errUpdate
+		return
+	}
+
+	err = nil
+	return
+}
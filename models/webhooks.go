@@ -0,0 +1,120 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// domain event types, a webhook can subscribe to any of them
+const (
+	EventIncomingItemCreated   = "incoming_item.created"
+	EventIncomingItemUpdated   = "incoming_item.updated"
+	EventIncomingItemCancelled = "incoming_item.cancelled"
+	EventOutgoingItemCreated   = "outgoing_item.created"
+	EventOutgoingItemUpdated   = "outgoing_item.updated"
+	EventOutgoingItemCancelled = "outgoing_item.cancelled"
+	EventProductCreated        = "product.created"
+	EventProductUpdated        = "product.updated"
+	EventProductStockChanged   = "product.stock_changed"
+	EventProductLowStock       = "product.low_stock"
+	// EventProductOverReserved is raised when a stock count leaves less in a warehouse than sales orders reserved
+	EventProductOverReserved = "product.over_reserved"
+)
+
+var WebhookEventTypes = []string{
+	EventIncomingItemCreated,
+	EventIncomingItemUpdated,
+	EventIncomingItemCancelled,
+	EventOutgoingItemCreated,
+	EventOutgoingItemUpdated,
+	EventOutgoingItemCancelled,
+	EventProductCreated,
+	EventProductUpdated,
+	EventProductStockChanged,
+	EventProductLowStock,
+	EventProductOverReserved,
+}
+
+const (
+	WebhookDeliveryStatusPending   = "pending"
+	WebhookDeliveryStatusSucceeded = "succeeded"
+	WebhookDeliveryStatusFailed    = "failed"
+)
+
+// WebhookSubscriptions receive the events of EventTypes at URL, every payload is signed with Secret
+type WebhookSubscriptions struct {
+	GormModel
+	URL        string         `gorm:"not null" json:"url" form:"url" valid:"required~Your webhook url is required,url~Invalid url format"`
+	Secret     string         `gorm:"not null" json:"secret,omitempty" form:"secret"`
+	EventTypes pq.StringArray `gorm:"type:text[];not null" json:"event_types" form:"event_types"`
+	Disabled   bool           `gorm:"not null;default:false" json:"disabled" form:"disabled"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+// WebhookDeliveries is the queue and the log of what was sent to a subscription, a delivery is retried
+// with exponential backoff until it succeeds or runs out of attempts. The deliveries of a product to one
+// subscription go out in order, one waiting for its retry holds back the later ones
+type WebhookDeliveries struct {
+	GormModel
+	WebhookSubscriptionID uint                  `gorm:"not null;index" json:"webhook_subscription_id"`
+	ProductID             uint                  `gorm:"not null;default:0;index" json:"product_id"`
+	EventType             string                `gorm:"not null;index" json:"event_type"`
+	Payload               RawJSON               `gorm:"type:jsonb;not null" json:"payload"`
+	Status                string                `gorm:"not null;index;default:pending" json:"status"`
+	Attempts              int                   `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt         time.Time             `gorm:"not null;index" json:"next_attempt_at"`
+	ResponseStatus        int                   `json:"response_status"`
+	LastError             string                `json:"last_error"`
+	DeliveredAt           *time.Time            `json:"delivered_at,omitempty"`
+	WebhookSubscriptions  *WebhookSubscriptions `gorm:"foreignKey:WebhookSubscriptionID;references:ID" json:"webhook_subscriptions,omitempty"`
+}
+
+func (w *WebhookSubscriptions) validateEventTypes() error {
+	if len(w.EventTypes) == 0 {
+		return errors.New("Your webhook needs at least one event type")
+	}
+
+	for _, eventType := range w.EventTypes {
+		if !govalidator.IsIn(eventType, WebhookEventTypes...) {
+			return errors.New("Unknown event type " + eventType)
+		}
+	}
+
+	return nil
+}
+
+func (w *WebhookSubscriptions) BeforeCreate(tx *gorm.DB) (err error) {
+	_, errCreate := govalidator.ValidateStruct(w)
+
+	if errCreate != nil {
+		err = errCreate
+		return
+	}
+
+	if err = w.validateEventTypes(); err != nil {
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (w *WebhookSubscriptions) BeforeUpdate(tx *gorm.DB) (err error) {
+	_, errUpdate := govalidator.ValidateStruct(w)
+
+	if errUpdate != nil {
+		err = errUpdate
+		return
+	}
+
+	if err = w.validateEventTypes(); err != nil {
+		return
+	}
+
+	err = nil
+	return
+}
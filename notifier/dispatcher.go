@@ -0,0 +1,186 @@
+package notifier
+
+import (
+	"encoding/json"
+	"inventoryapp/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxAttempts is how often an alert is tried before it is given up
+	MaxAttempts = 8
+	batchSize   = 20
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+	// claimLease has to outlast notifying a whole batch, a claim older than that is taken over
+	claimLease = 5 * time.Minute
+)
+
+// Backoff is the wait after the given number of failed attempts, it doubles every attempt up to an hour
+func Backoff(attempts int) time.Duration {
+	backoff := baseBackoff
+
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
+
+// DeliverDue hands the alerts that are due to the notifier and returns how many were attempted. The alerts are
+// claimed first in a short transaction, locked with SKIP LOCKED so several dispatchers never claim the same one,
+// by moving their next attempt claimLease ahead. Every alert is then delivered in a transaction of its own
+func DeliverDue(db *gorm.DB) (int, error) {
+	deliveries, err := claim(db, time.Now())
+
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range deliveries {
+		if err := attempt(db, deliveries[i]); err != nil {
+			log.Printf("notifier: recording alert %d failed: %s", deliveries[i].ID, err)
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// claim takes the alerts due at now for this dispatcher
+func claim(db *gorm.DB, now time.Time) ([]models.AlertDeliveries, error) {
+	tx := db.Begin()
+
+	deliveries := []models.AlertDeliveries{}
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_attempt_at <= ?", models.AlertDeliveryStatusPending, now).
+		Order("next_attempt_at, id").
+		Limit(batchSize).
+		Find(&deliveries).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if len(deliveries) == 0 {
+		tx.Rollback()
+		return deliveries, nil
+	}
+
+	ids := make([]uint, 0, len(deliveries))
+
+	for _, Delivery := range deliveries {
+		ids = append(ids, Delivery.ID)
+	}
+
+	if err := tx.Debug().Model(&models.AlertDeliveries{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(claimLease)).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// attempt hands Delivery to the notifier once. Whatever the notifier writes commits together with marking the
+// alert delivered, a failure rolls it back and only records the failed attempt
+func attempt(db *gorm.DB, Delivery models.AlertDeliveries) error {
+	alert := Alert{}
+	notifyErr := json.Unmarshal(Delivery.Payload, &alert)
+
+	tx := db.Begin()
+
+	if notifyErr == nil {
+		notifyErr = current.Notify(tx, alert)
+	}
+
+	if notifyErr == nil {
+		result := tx.Debug().Model(&Delivery).Where("status = ? AND attempts = ?", models.AlertDeliveryStatusPending, Delivery.Attempts).
+			Updates(outcome(Delivery, nil, time.Now()))
+
+		if result.Error != nil {
+			tx.Rollback()
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			// another dispatcher took the alert over meanwhile
+			tx.Rollback()
+			return nil
+		}
+
+		return tx.Commit().Error
+	}
+
+	tx.Rollback()
+
+	return db.Debug().Model(&Delivery).Where("status = ? AND attempts = ?", models.AlertDeliveryStatusPending, Delivery.Attempts).
+		Updates(outcome(Delivery, notifyErr, time.Now())).Error
+}
+
+// outcome is what an attempt at Delivery that failed with notifyErr changes on it, a failure is retried
+// after Backoff until MaxAttempts are used up
+func outcome(Delivery models.AlertDeliveries, notifyErr error, now time.Time) map[string]interface{} {
+	changes := map[string]interface{}{
+		"attempts": Delivery.Attempts + 1,
+	}
+
+	if notifyErr == nil {
+		changes["status"] = models.AlertDeliveryStatusDelivered
+		changes["delivered_at"] = now
+		changes["last_error"] = ""
+
+		return changes
+	}
+
+	changes["last_error"] = notifyErr.Error()
+
+	if Delivery.Attempts+1 >= MaxAttempts {
+		changes["status"] = models.AlertDeliveryStatusFailed
+	} else {
+		changes["next_attempt_at"] = now.Add(Backoff(Delivery.Attempts + 1))
+	}
+
+	return changes
+}
+
+// StartDispatcher delivers due alerts every interval in the background until stop is called
+func StartDispatcher(db *gorm.DB, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for {
+					count, err := DeliverDue(db)
+
+					if err != nil {
+						log.Printf("notifier: delivering failed: %s", err)
+					}
+
+					if err != nil || count < batchSize {
+						break
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
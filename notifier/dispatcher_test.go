@@ -0,0 +1,46 @@
+package notifier
+
+import (
+	"errors"
+	"inventoryapp/models"
+	"testing"
+	"time"
+)
+
+func TestFailedAlertsAreRetriedUntilTheyAreGivenUp(t *testing.T) {
+	now := time.Now()
+	Delivery := models.AlertDeliveries{Status: models.AlertDeliveryStatusPending}
+
+	for Delivery.Attempts+1 < MaxAttempts {
+		changes := outcome(Delivery, errors.New("webhook answered 502 Bad Gateway"), now)
+
+		if got, want := changes["next_attempt_at"], now.Add(Backoff(Delivery.Attempts+1)); got != want {
+			t.Fatalf("attempt %d retries at %v, want %v", Delivery.Attempts+1, got, want)
+		}
+
+		if _, ok := changes["status"]; ok {
+			t.Fatalf("attempt %d changed the status to %v", Delivery.Attempts+1, changes["status"])
+		}
+
+		Delivery.Attempts++
+	}
+
+	changes := outcome(Delivery, errors.New("webhook answered 502 Bad Gateway"), now)
+
+	if changes["status"] != models.AlertDeliveryStatusFailed {
+		t.Fatalf("the last attempt left the status at %v", changes["status"])
+	}
+
+	if _, ok := changes["next_attempt_at"]; ok {
+		t.Fatal("a given up alert is retried")
+	}
+}
+
+func TestDeliveredAlertsAreMarkedDelivered(t *testing.T) {
+	now := time.Now()
+	changes := outcome(models.AlertDeliveries{Attempts: 2}, nil, now)
+
+	if changes["status"] != models.AlertDeliveryStatusDelivered || changes["delivered_at"] != now || changes["attempts"] != 3 {
+		t.Fatalf("a delivered alert changes %v", changes)
+	}
+}
@@ -0,0 +1,16 @@
+package notifier
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// LogNotifier writes alerts to the standard logger, it needs nothing else to run
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(tx *gorm.DB, alert Alert) error {
+	log.Printf("notifier: %s: %s (stock %s, reorder point %s)", alert.Type, alert.Subject, alert.Stock, alert.ReorderPoint)
+
+	return nil
+}
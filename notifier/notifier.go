@@ -0,0 +1,90 @@
+// Package notifier delivers alerts raised while a request changes stock. Alerts are recorded in the outbox
+// in the transaction of the change and outbox.NotifierSink queues them with Enqueue, so a rolled back change
+// never alerts anybody. The dispatcher of this package delivers the queue on its own, a failing notifier is
+// retried without holding back the outbox and gives up after MaxAttempts
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"inventoryapp/models"
+	"os"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const AlertTypeLowStock = "low_stock"
+
+type Alert struct {
+	Type         string          `json:"type"`
+	Subject      string          `json:"subject"`
+	ProductID    uint            `json:"product_id"`
+	ProductName  string          `json:"product_name"`
+	WarehouseID  uint            `json:"warehouse_id"`
+	Stock        decimal.Decimal `json:"stock"`
+	ReorderPoint decimal.Decimal `json:"reorder_point"`
+	SafetyStock  decimal.Decimal `json:"safety_stock"`
+	ReorderQty   decimal.Decimal `json:"reorder_qty"`
+	RaisedAt     time.Time       `json:"raised_at"`
+}
+
+// Notifier is where alerts end up, see LogNotifier, WebhookNotifier and OutboxNotifier. tx is the transaction
+// that marks the alert delivered, a notifier writing to the database writes through it
+type Notifier interface {
+	Notify(tx *gorm.DB, alert Alert) error
+}
+
+var current Notifier = LogNotifier{}
+
+// Use replaces the notifier alerts are delivered to
+func Use(n Notifier) {
+	current = n
+}
+
+// Setup picks the notifier named by NOTIFIER: log (the default), webhook posting to NOTIFIER_WEBHOOK_URL
+// or outbox queueing mails to NOTIFIER_EMAIL_TO
+func Setup() error {
+	switch os.Getenv("NOTIFIER") {
+	case "", "log":
+		Use(LogNotifier{})
+	case "webhook":
+		url := os.Getenv("NOTIFIER_WEBHOOK_URL")
+
+		if url == "" {
+			return errors.New("NOTIFIER_WEBHOOK_URL is required for the webhook notifier")
+		}
+
+		Use(NewWebhookNotifier(url))
+	case "outbox":
+		recipient := os.Getenv("NOTIFIER_EMAIL_TO")
+
+		if recipient == "" {
+			return errors.New("NOTIFIER_EMAIL_TO is required for the outbox notifier")
+		}
+
+		Use(OutboxNotifier{Recipient: recipient})
+	default:
+		return errors.New("NOTIFIER must be one of log, webhook or outbox")
+	}
+
+	return nil
+}
+
+// Enqueue queues alert for the dispatcher in tx
+func Enqueue(tx *gorm.DB, alert Alert) error {
+	payload, err := json.Marshal(alert)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Debug().Create(&models.AlertDeliveries{
+		AlertType:     alert.Type,
+		ProductID:     alert.ProductID,
+		Payload:       models.RawJSON(payload),
+		Status:        models.AlertDeliveryStatusPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
@@ -0,0 +1,24 @@
+package notifier
+
+import (
+	"fmt"
+	"inventoryapp/models"
+
+	"gorm.io/gorm"
+)
+
+// OutboxNotifier queues every alert as a mail to Recipient in the outbox_emails table, in the transaction that
+// marks the alert delivered
+type OutboxNotifier struct {
+	Recipient string
+}
+
+func (n OutboxNotifier) Notify(tx *gorm.DB, alert Alert) error {
+	return tx.Debug().Create(&models.OutboxEmails{
+		Recipient: n.Recipient,
+		Subject:   alert.Subject,
+		Body: fmt.Sprintf("Product %d (%s) is down to %s, its reorder point is %s and its safety stock %s. Suggested order: %s.",
+			alert.ProductID, alert.ProductName, alert.Stock, alert.ReorderPoint, alert.SafetyStock, alert.ReorderQty),
+		Status: models.OutboxEmailStatusPending,
+	}).Error
+}
@@ -0,0 +1,43 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookNotifier posts every alert as JSON to URL, any answer but 2xx is a failed delivery
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) WebhookNotifier {
+	return WebhookNotifier{URL: url, Client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (n WebhookNotifier) Notify(tx *gorm.DB, alert Alert) error {
+	body, err := json.Marshal(alert)
+
+	if err != nil {
+		return err
+	}
+
+	response, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package outbox
+
+import (
+	"fmt"
+	"inventoryapp/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAttempts is how often an event is tried before it is given up, about an hour and a half of retries
+	MaxAttempts = 25
+	batchSize   = 100
+	baseBackoff = time.Second
+	maxBackoff  = 5 * time.Minute
+	// dispatcherLockKey is the advisory lock that keeps a single dispatcher publishing at a time,
+	// which is what keeps the events of a product in order
+	dispatcherLockKey = 727001
+)
+
+// Backoff is the wait after the given number of failed attempts, it doubles every attempt up to five minutes.
+// The later events of the product wait for the retry
+func Backoff(attempts int) time.Duration {
+	backoff := baseBackoff
+
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
+
+// PublishDue publishes the unpublished events in the order they were written and returns how many went out.
+// Products with an event waiting for its retry are left out of the batch, so they never crowd out the others.
+// It does nothing while another dispatcher holds the lock
+func PublishDue(db *gorm.DB) (int, error) {
+	tx := db.Begin()
+
+	locked := false
+	if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", dispatcherLockKey).Scan(&locked).Error; err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if !locked {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	now := time.Now()
+
+	events := []models.OutboxEvents{}
+	if err := tx.Debug().
+		Where("published_at IS NULL AND failed_at IS NULL").
+		Where("product_id NOT IN (SELECT product_id FROM outbox_events WHERE published_at IS NULL AND failed_at IS NULL AND next_attempt_at > ?)", now).
+		Order("id").
+		Limit(batchSize).
+		Find(&events).Error; err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	blocked := map[uint]bool{}
+	published := 0
+
+	for i := range events {
+		Event := &events[i]
+
+		if blocked[Event.ProductID] {
+			continue
+		}
+
+		// an event waiting for its retry holds back the events after it
+		if Event.NextAttemptAt.After(now) {
+			blocked[Event.ProductID] = true
+			continue
+		}
+
+		if err := publish(tx, *Event); err != nil {
+			changes := map[string]interface{}{
+				"attempts":   Event.Attempts + 1,
+				"last_error": err.Error(),
+			}
+
+			// a given up event stays in the outbox for inspection, the later events of its product go ahead
+			if Event.Attempts+1 >= MaxAttempts {
+				changes["failed_at"] = now
+			} else {
+				changes["next_attempt_at"] = now.Add(Backoff(Event.Attempts + 1))
+				blocked[Event.ProductID] = true
+			}
+
+			if err := tx.Debug().Model(Event).Updates(changes).Error; err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+
+			continue
+		}
+
+		if err := tx.Debug().Model(Event).Updates(map[string]interface{}{
+			"attempts":     Event.Attempts + 1,
+			"last_error":   "",
+			"published_at": now,
+		}).Error; err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		published++
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+
+	return published, nil
+}
+
+// publish hands Event to every sink, a sink that fails undoes what the sinks wrote for the event
+func publish(tx *gorm.DB, Event models.OutboxEvents) error {
+	savepoint := fmt.Sprintf("outbox_event_%d", Event.ID)
+
+	if err := tx.SavePoint(savepoint).Error; err != nil {
+		return err
+	}
+
+	for _, sink := range sinks {
+		if err := sink.Publish(tx, Event); err != nil {
+			if rollbackErr := tx.RollbackTo(savepoint).Error; rollbackErr != nil {
+				return rollbackErr
+			}
+
+			return fmt.Errorf("%s: %w", sink.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// StartDispatcher publishes due events every interval in the background until stop is called
+func StartDispatcher(db *gorm.DB, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for {
+					count, err := PublishDue(db)
+
+					if err != nil {
+						log.Printf("outbox: publishing failed: %s", err)
+					}
+
+					if err != nil || count < batchSize {
+						break
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,75 @@
+// Package outbox keeps domain events in the outbox_events table, written in the transaction of the change,
+// and publishes them to the registered sinks at least once. Events of one product are published in order,
+// an event that fails holds back the later events of its product until it went out or was given up
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"inventoryapp/models"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sink is where published events go. Publish may see an event more than once and runs in the transaction
+// that marks the event published, an error rolls the sink's own writes back
+type Sink interface {
+	Name() string
+	Publish(tx *gorm.DB, Event models.OutboxEvents) error
+}
+
+var sinks []Sink
+
+// Register adds sink to the sinks every event is published to, in the order they were registered
+func Register(sink Sink) {
+	sinks = append(sinks, sink)
+}
+
+// Stream is the server-sent events sink, its clients are served by the events stream endpoint
+var Stream = NewSSESink()
+
+// Setup registers the sinks named by OUTBOX_SINKS, a comma separated list of webhook, sse, notifier and log.
+// Without it events go to webhooks, to the event stream and low-stock alerts to the notifier
+func Setup() error {
+	names := os.Getenv("OUTBOX_SINKS")
+
+	if names == "" {
+		names = "webhook,sse,notifier"
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "webhook":
+			Register(WebhookSink{})
+		case "sse":
+			Register(Stream)
+		case "notifier":
+			Register(NotifierSink{})
+		case "log":
+			Register(LogSink{})
+		default:
+			return errors.New("OUTBOX_SINKS may only name webhook, sse, notifier and log")
+		}
+	}
+
+	return nil
+}
+
+// Record writes eventType about the product with data into the outbox, tx is the transaction of the change
+func Record(tx *gorm.DB, eventType string, productID uint, data interface{}) error {
+	payload, err := json.Marshal(data)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Debug().Create(&models.OutboxEvents{
+		EventType:     eventType,
+		ProductID:     productID,
+		Payload:       payload,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"encoding/json"
+	"inventoryapp/models"
+	"inventoryapp/notifier"
+	"inventoryapp/webhooks"
+	"log"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// WebhookSink queues the event for the webhook subscriptions of its type, in the dispatcher's transaction
+type WebhookSink struct{}
+
+func (WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (WebhookSink) Publish(tx *gorm.DB, Event models.OutboxEvents) error {
+	return webhooks.Enqueue(tx, Event.ProductID, webhooks.Event{
+		ID:         Event.ID,
+		Event:      Event.EventType,
+		OccurredAt: *Event.CreatedAt,
+		Data:       json.RawMessage(Event.Payload),
+	})
+}
+
+// NotifierSink queues low-stock events for the notifier in the dispatcher's transaction, the notifier delivers
+// them on its own so a slow or failing notifier never holds back the outbox
+type NotifierSink struct{}
+
+func (NotifierSink) Name() string {
+	return "notifier"
+}
+
+func (NotifierSink) Publish(tx *gorm.DB, Event models.OutboxEvents) error {
+	if Event.EventType != models.EventProductLowStock {
+		return nil
+	}
+
+	alert := notifier.Alert{}
+
+	if err := json.Unmarshal(Event.Payload, &alert); err != nil {
+		return err
+	}
+
+	return notifier.Enqueue(tx, alert)
+}
+
+// LogSink writes every event to the standard logger
+type LogSink struct{}
+
+func (LogSink) Name() string {
+	return "log"
+}
+
+func (LogSink) Publish(tx *gorm.DB, Event models.OutboxEvents) error {
+	log.Printf("outbox: event %d %s of product %d: %s", Event.ID, Event.EventType, Event.ProductID, Event.Payload)
+
+	return nil
+}
+
+// SSESink fans events out to the clients of the event stream. A client that falls behind by more
+// than its buffer loses events and catches up by reconnecting with the last event id it saw
+type SSESink struct {
+	mu      sync.Mutex
+	clients map[chan models.OutboxEvents]struct{}
+}
+
+const sseClientBuffer = 64
+
+func NewSSESink() *SSESink {
+	return &SSESink{clients: map[chan models.OutboxEvents]struct{}{}}
+}
+
+func (s *SSESink) Name() string {
+	return "sse"
+}
+
+func (s *SSESink) Publish(tx *gorm.DB, Event models.OutboxEvents) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for client := range s.clients {
+		select {
+		case client <- Event:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Subscribe registers a client, the returned func unregisters it
+func (s *SSESink) Subscribe() (<-chan models.OutboxEvents, func()) {
+	client := make(chan models.OutboxEvents, sseClientBuffer)
+
+	s.mu.Lock()
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+
+	return client, func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}
+}
@@ -3,39 +3,252 @@ package router
 import (
 	"inventoryapp/controllers"
 	"inventoryapp/middlewares"
+	"inventoryapp/models"
+	"log"
+	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
+// trustedProxies reads TRUSTED_PROXIES, a comma separated list of the IPs or CIDRs of the load balancers in front of
+// the api. Only those may set X-Forwarded-For, without it the client IP is the address of the connection itself.
+// The client IP guards API key allowlists and login throttling and lands in the audit log, so don't trust more than
+// the proxies you run
+func trustedProxies() []string {
+	var proxies []string
+
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+
+	return proxies
+}
+
 func StartServer() *gin.Engine {
 	r := gin.Default()
 
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal(err)
+	}
+
+	// who may call which route, viewers only read, clerks book the daily work, managers cancel, close and archive
+	// and admins also manage users and webhooks. Routes missing here are refused to everyone
+	everyone := []string{models.RoleAdmin, models.RoleWarehouseManager, models.RoleClerk, models.RoleViewer}
+	staff := []string{models.RoleAdmin, models.RoleWarehouseManager, models.RoleClerk}
+	managers := []string{models.RoleAdmin, models.RoleWarehouseManager}
+	admins := []string{models.RoleAdmin}
+
+	permissions := middlewares.Permissions{
+		"PUT /users/role/:userId":   admins,
+		"PUT /users/unlock/:userId": admins,
+		"PUT /users/unlock-ip/:ip":  admins,
+
+		"GET /products/":                            everyone,
+		"GET /products/:productId":                  everyone,
+		"GET /products/:productId/movements":        everyone,
+		"GET /products/:productId/units":            everyone,
+		"POST /products/:productId/units":           staff,
+		"DELETE /products/:productId/units/:unitId": managers,
+		"POST /products/":                           staff,
+		"PUT /products/:productId":                  staff,
+		"DELETE /products/:productId":               managers,
+
+		"GET /warehouses/":                everyone,
+		"GET /warehouses/:warehouseId":    everyone,
+		"POST /warehouses/":               staff,
+		"PUT /warehouses/:warehouseId":    staff,
+		"DELETE /warehouses/:warehouseId": managers,
+
+		"GET /suppliers/":               everyone,
+		"GET /suppliers/:supplierId":    everyone,
+		"POST /suppliers/":              staff,
+		"PUT /suppliers/:supplierId":    staff,
+		"DELETE /suppliers/:supplierId": managers,
+
+		"GET /customers/":                           everyone,
+		"GET /customers/:customerId":                everyone,
+		"GET /customers/:customerId/outgoing-items": everyone,
+		"GET /customers/:customerId/totals":         everyone,
+		"POST /customers/":                          staff,
+		"PUT /customers/:customerId":                staff,
+		"DELETE /customers/:customerId":             managers,
+
+		"GET /purchase-orders/":                           everyone,
+		"GET /purchase-orders/:purchaseOrderId":           everyone,
+		"POST /purchase-orders/":                          staff,
+		"PUT /purchase-orders/:purchaseOrderId":           staff,
+		"POST /purchase-orders/:purchaseOrderId/receipts": staff,
+		"PUT /purchase-orders/close/:purchaseOrderId":     managers,
+		"PUT /purchase-orders/cancel/:purchaseOrderId":    managers,
+
+		"GET /sales-orders/":                         everyone,
+		"GET /sales-orders/:salesOrderId":            everyone,
+		"POST /sales-orders/":                        staff,
+		"PUT /sales-orders/:salesOrderId":            staff,
+		"PUT /sales-orders/confirm/:salesOrderId":    staff,
+		"POST /sales-orders/:salesOrderId/shipments": staff,
+		"PUT /sales-orders/cancel/:salesOrderId":     managers,
+
+		"GET /incoming-items/":                       everyone,
+		"GET /incoming-items/:incomingItemId":        everyone,
+		"POST /incoming-items/":                      staff,
+		"PUT /incoming-items/:incomingItemId":        staff,
+		"PUT /incoming-items/cancel/:incomingItemId": managers,
+
+		"GET /outgoing-items/":                       everyone,
+		"GET /outgoing-items/:outgoingItemId":        everyone,
+		"POST /outgoing-items/":                      staff,
+		"PUT /outgoing-items/:outgoingItemId":        staff,
+		"PUT /outgoing-items/cancel/:outgoingItemId": managers,
+
+		"GET /transfers/":                     everyone,
+		"GET /transfers/in-transit":           everyone,
+		"GET /transfers/:transferId":          everyone,
+		"POST /transfers/":                    staff,
+		"PUT /transfers/:transferId":          staff,
+		"PUT /transfers/dispatch/:transferId": staff,
+		"PUT /transfers/receive/:transferId":  staff,
+		"PUT /transfers/cancel/:transferId":   managers,
+
+		"GET /stock-counts/":                        everyone,
+		"GET /stock-counts/:stockCountId":           everyone,
+		"GET /stock-counts/:stockCountId/variances": everyone,
+		"POST /stock-counts/":                       staff,
+		"POST /stock-counts/:stockCountId/entries":  staff,
+		"PUT /stock-counts/post/:stockCountId":      managers,
+		"PUT /stock-counts/cancel/:stockCountId":    managers,
+
+		"GET /lots/":         everyone,
+		"GET /lots/expiring": everyone,
+
+		"GET /serials/:serial": everyone,
+
+		"GET /webhooks/":                                             admins,
+		"GET /webhooks/:webhookId":                                   admins,
+		"GET /webhooks/:webhookId/deliveries":                        admins,
+		"POST /webhooks/:webhookId/deliveries/:deliveryId/redeliver": admins,
+		"POST /webhooks/":                                            admins,
+		"PUT /webhooks/:webhookId":                                   admins,
+		"DELETE /webhooks/:webhookId":                                admins,
+
+		"GET /service-accounts/":  admins,
+		"POST /service-accounts/": admins,
+
+		"GET /api-keys/":                 admins,
+		"GET /api-keys/:apiKeyId":        admins,
+		"POST /api-keys/":                admins,
+		"PUT /api-keys/revoke/:apiKeyId": admins,
+
+		"GET /events/":       everyone,
+		"GET /events/stream": everyone,
+
+		"GET /audit-logs/": managers,
+
+		"GET /reports/valuation": everyone,
+		"GET /reports/low-stock": everyone,
+	}
+
+	models.KnownAPIKeyScopes = permissions.Scopes()
+
+	r.Use(middlewares.RequestID())
+
 	userRouter := r.Group("/users")
 	{
 		userRouter.POST("register", controllers.UserRegister)
 
 		userRouter.POST("login", controllers.UserLogin)
 
-		userRouter.POST("logout", controllers.UserLogout)
+		userRouter.POST("refresh", controllers.UserRefresh)
 
-		userRouter.GET("profile", controllers.UserProfile)
+		userRouter.POST("logout", middlewares.Authentication(), controllers.UserLogout)
+
+		userRouter.GET("profile", middlewares.Authentication(), controllers.UserProfile)
+
+		userRouter.PUT("role/:userId", middlewares.Authentication(), middlewares.Authorization(permissions), controllers.UpdateUserRole)
+
+		userRouter.PUT("unlock/:userId", middlewares.Authentication(), middlewares.Authorization(permissions), controllers.UnlockUser)
+
+		userRouter.PUT("unlock-ip/:ip", middlewares.Authentication(), middlewares.Authorization(permissions), controllers.UnlockIP)
 	}
 
 	productRouter := r.Group("/products")
 	{
-		productRouter.Use(middlewares.Authentication())
+		productRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
 		productRouter.GET("/", controllers.GetProducts)
 		productRouter.GET("/:productId", controllers.GetProducts)
+		productRouter.GET("/:productId/movements", controllers.GetProductMovements)
+		productRouter.GET("/:productId/units", controllers.GetUnitConversions)
+		productRouter.POST("/:productId/units", controllers.CreateUnitConversion)
+		productRouter.DELETE("/:productId/units/:unitId", controllers.DeleteUnitConversion)
 		productRouter.POST("/", controllers.CreateProduct)
 		productRouter.PUT("/:productId", controllers.UpdateProduct)
 		productRouter.DELETE("/:productId", controllers.DeleteProduct)
 	}
 
+	warehouseRouter := r.Group("/warehouses")
+	{
+		warehouseRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		warehouseRouter.GET("/", controllers.GetWarehouses)
+		warehouseRouter.GET("/:warehouseId", controllers.GetWarehouses)
+		warehouseRouter.POST("/", controllers.CreateWarehouse)
+		warehouseRouter.PUT("/:warehouseId", controllers.UpdateWarehouse)
+		warehouseRouter.DELETE("/:warehouseId", controllers.DeleteWarehouse)
+	}
+
+	supplierRouter := r.Group("/suppliers")
+	{
+		supplierRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		supplierRouter.GET("/", controllers.GetSuppliers)
+		supplierRouter.GET("/:supplierId", controllers.GetSuppliers)
+		supplierRouter.POST("/", controllers.CreateSupplier)
+		supplierRouter.PUT("/:supplierId", controllers.UpdateSupplier)
+		supplierRouter.DELETE("/:supplierId", controllers.DeleteSupplier)
+	}
+
+	customerRouter := r.Group("/customers")
+	{
+		customerRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		customerRouter.GET("/", controllers.GetCustomers)
+		customerRouter.GET("/:customerId", controllers.GetCustomers)
+		customerRouter.GET("/:customerId/outgoing-items", controllers.GetCustomerOutgoingItems)
+		customerRouter.GET("/:customerId/totals", controllers.GetCustomerTotals)
+		customerRouter.POST("/", controllers.CreateCustomer)
+		customerRouter.PUT("/:customerId", controllers.UpdateCustomer)
+		customerRouter.DELETE("/:customerId", controllers.DeleteCustomer)
+	}
+
+	purchaseOrderRouter := r.Group("/purchase-orders")
+	{
+		purchaseOrderRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		purchaseOrderRouter.GET("/", controllers.GetPurchaseOrders)
+		purchaseOrderRouter.GET("/:purchaseOrderId", controllers.GetPurchaseOrders)
+		purchaseOrderRouter.POST("/", controllers.CreatePurchaseOrder)
+		purchaseOrderRouter.PUT("/:purchaseOrderId", controllers.UpdatePurchaseOrder)
+		purchaseOrderRouter.POST("/:purchaseOrderId/receipts", controllers.ReceivePurchaseOrder)
+		purchaseOrderRouter.PUT("/close/:purchaseOrderId", controllers.ClosePurchaseOrder)
+		purchaseOrderRouter.PUT("/cancel/:purchaseOrderId", controllers.CancelPurchaseOrder)
+	}
+
+	salesOrderRouter := r.Group("/sales-orders")
+	{
+		salesOrderRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		salesOrderRouter.GET("/", controllers.GetSalesOrders)
+		salesOrderRouter.GET("/:salesOrderId", controllers.GetSalesOrders)
+		salesOrderRouter.POST("/", controllers.CreateSalesOrder)
+		salesOrderRouter.PUT("/:salesOrderId", controllers.UpdateSalesOrder)
+		salesOrderRouter.PUT("/confirm/:salesOrderId", controllers.ConfirmSalesOrder)
+		salesOrderRouter.POST("/:salesOrderId/shipments", controllers.ShipSalesOrder)
+		salesOrderRouter.PUT("/cancel/:salesOrderId", controllers.CancelSalesOrder)
+	}
+
 	incomingItemRouter := r.Group("/incoming-items")
 	{
-		incomingItemRouter.Use(middlewares.Authentication())
+		incomingItemRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
 		incomingItemRouter.GET("/", controllers.GetIncomingItems)
 		incomingItemRouter.GET("/:incomingItemId", controllers.GetIncomingItems)
 		incomingItemRouter.POST("/", controllers.CreateIncomingItem)
@@ -45,7 +258,7 @@ func StartServer() *gin.Engine {
 
 	outgoingItemRouter := r.Group("/outgoing-items")
 	{
-		outgoingItemRouter.Use(middlewares.Authentication())
+		outgoingItemRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
 		outgoingItemRouter.GET("/", controllers.GetOutgoingItems)
 		outgoingItemRouter.GET("/:outgoingItemId", controllers.GetOutgoingItems)
 		outgoingItemRouter.POST("/", controllers.CreateOutgoingItem)
@@ -53,6 +266,94 @@ func StartServer() *gin.Engine {
 		outgoingItemRouter.PUT("/cancel/:outgoingItemId", controllers.CancelOutgoingItem)
 	}
 
+	transferRouter := r.Group("/transfers")
+	{
+		transferRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		transferRouter.GET("/", controllers.GetTransfers)
+		transferRouter.GET("/in-transit", controllers.GetInTransit)
+		transferRouter.GET("/:transferId", controllers.GetTransfers)
+		transferRouter.POST("/", controllers.CreateTransfer)
+		transferRouter.PUT("/:transferId", controllers.UpdateTransfer)
+		transferRouter.PUT("/dispatch/:transferId", controllers.DispatchTransfer)
+		transferRouter.PUT("/receive/:transferId", controllers.ReceiveTransfer)
+		transferRouter.PUT("/cancel/:transferId", controllers.CancelTransfer)
+	}
+
+	stockCountRouter := r.Group("/stock-counts")
+	{
+		stockCountRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		stockCountRouter.GET("/", controllers.GetStockCounts)
+		stockCountRouter.GET("/:stockCountId", controllers.GetStockCounts)
+		stockCountRouter.GET("/:stockCountId/variances", controllers.GetStockCountVariances)
+		stockCountRouter.POST("/", controllers.CreateStockCount)
+		stockCountRouter.POST("/:stockCountId/entries", controllers.CreateStockCountEntry)
+		stockCountRouter.PUT("/post/:stockCountId", controllers.PostStockCount)
+		stockCountRouter.PUT("/cancel/:stockCountId", controllers.CancelStockCount)
+	}
+
+	stockLotRouter := r.Group("/lots")
+	{
+		stockLotRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		stockLotRouter.GET("/", controllers.GetStockLots)
+		stockLotRouter.GET("/expiring", controllers.GetExpiringStockLots)
+	}
+
+	serialRouter := r.Group("/serials")
+	{
+		serialRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		serialRouter.GET("/:serial", controllers.GetSerialNumber)
+	}
+
+	webhookRouter := r.Group("/webhooks")
+	{
+		webhookRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		webhookRouter.GET("/", controllers.GetWebhooks)
+		webhookRouter.GET("/:webhookId", controllers.GetWebhooks)
+		webhookRouter.GET("/:webhookId/deliveries", controllers.GetWebhookDeliveries)
+		webhookRouter.POST("/:webhookId/deliveries/:deliveryId/redeliver", controllers.RedeliverWebhook)
+		webhookRouter.POST("/", controllers.CreateWebhook)
+		webhookRouter.PUT("/:webhookId", controllers.UpdateWebhook)
+		webhookRouter.DELETE("/:webhookId", controllers.DeleteWebhook)
+	}
+
+	serviceAccountRouter := r.Group("/service-accounts")
+	{
+		serviceAccountRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		serviceAccountRouter.GET("/", controllers.GetServiceAccounts)
+		serviceAccountRouter.POST("/", controllers.CreateServiceAccount)
+	}
+
+	apiKeyRouter := r.Group("/api-keys")
+	{
+		apiKeyRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		apiKeyRouter.GET("/", controllers.GetAPIKeys)
+		apiKeyRouter.GET("/:apiKeyId", controllers.GetAPIKeys)
+		apiKeyRouter.POST("/", controllers.CreateAPIKey)
+		apiKeyRouter.PUT("/revoke/:apiKeyId", controllers.RevokeAPIKey)
+	}
+
+	eventRouter := r.Group("/events")
+	{
+		eventRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		eventRouter.GET("/", controllers.GetOutboxEvents)
+		eventRouter.GET("/stream", controllers.StreamEvents)
+	}
+
+	auditLogRouter := r.Group("/audit-logs")
+	{
+		auditLogRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		auditLogRouter.GET("/", controllers.GetAuditLogs)
+	}
+
+	reportRouter := r.Group("/reports")
+	{
+		reportRouter.Use(middlewares.Authentication(), middlewares.Authorization(permissions))
+		reportRouter.GET("/valuation", controllers.GetValuationReport)
+		reportRouter.GET("/low-stock", controllers.GetLowStockReport)
+	}
+
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
+
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	return r
@@ -0,0 +1,212 @@
+package webhooks
+
+import (
+	"bytes"
+	"fmt"
+	"inventoryapp/models"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxAttempts is how often a delivery is tried before it is given up
+	MaxAttempts = 8
+	batchSize   = 20
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+	// claimLease has to outlast sending a whole batch, a claim older than that is taken over
+	claimLease = 5 * time.Minute
+)
+
+// Backoff is the wait after the given number of failed attempts, it doubles every attempt up to an hour
+func Backoff(attempts int) time.Duration {
+	backoff := baseBackoff
+
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
+
+// DeliverDue sends the deliveries that are due and returns how many were attempted. Only the first pending
+// delivery of a product to a subscription is due, so a delivery waiting for its retry holds back the later
+// events of its product and receivers get them in order. The deliveries are claimed
+// first in a short transaction, locked with SKIP LOCKED so several dispatchers never claim the same one, by moving
+// their next attempt claimLease ahead. They are sent without holding any lock and every outcome is recorded on its
+// own, a dispatcher that dies in between leaves its claims to be retried once the lease runs out
+func DeliverDue(db *gorm.DB, client *http.Client) (int, error) {
+	deliveries, err := claim(db, time.Now())
+
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range deliveries {
+		if err := attempt(db, client, deliveries[i]); err != nil {
+			log.Printf("webhooks: recording delivery %d failed: %s", deliveries[i].ID, err)
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// claim takes the deliveries due at now for this dispatcher
+func claim(db *gorm.DB, now time.Time) ([]models.WebhookDeliveries, error) {
+	tx := db.Begin()
+
+	deliveries := []models.WebhookDeliveries{}
+	if err := tx.Debug().Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryStatusPending, now).
+		Where("NOT EXISTS (SELECT 1 FROM webhook_deliveries earlier WHERE earlier.webhook_subscription_id = webhook_deliveries.webhook_subscription_id AND earlier.product_id = webhook_deliveries.product_id AND earlier.status = ? AND earlier.id < webhook_deliveries.id)", models.WebhookDeliveryStatusPending).
+		Order("next_attempt_at, id").
+		Limit(batchSize).
+		Find(&deliveries).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if len(deliveries) == 0 {
+		tx.Rollback()
+		return deliveries, nil
+	}
+
+	ids := make([]uint, 0, len(deliveries))
+
+	for _, Delivery := range deliveries {
+		ids = append(ids, Delivery.ID)
+	}
+
+	if err := tx.Debug().Model(&models.WebhookDeliveries{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(claimLease)).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// attempt sends Delivery once and records the outcome on it, unless another dispatcher took it over meanwhile
+func attempt(db *gorm.DB, client *http.Client, Delivery models.WebhookDeliveries) error {
+	Subscription := models.WebhookSubscriptions{}
+
+	if err := db.Debug().Unscoped().Where("id = ?", Delivery.WebhookSubscriptionID).First(&Subscription).Error; err != nil {
+		return err
+	}
+
+	changes := map[string]interface{}{}
+
+	if Subscription.DeletedAt.Valid || Subscription.Disabled {
+		// nobody wants the event anymore, it stays in the log
+		changes["attempts"] = Delivery.Attempts + 1
+		changes["status"] = models.WebhookDeliveryStatusFailed
+		changes["last_error"] = "subscription is disabled or deleted"
+	} else {
+		status, sendErr := send(client, Subscription, Delivery)
+		changes = outcome(Delivery, status, sendErr, time.Now())
+	}
+
+	return db.Debug().Model(&Delivery).Where("status = ? AND attempts = ?", models.WebhookDeliveryStatusPending, Delivery.Attempts).Updates(changes).Error
+}
+
+// outcome is what an attempt at Delivery answered with status and sendErr changes on it, a failure is retried
+// after Backoff until MaxAttempts are used up
+func outcome(Delivery models.WebhookDeliveries, status int, sendErr error, now time.Time) map[string]interface{} {
+	changes := map[string]interface{}{
+		"attempts":        Delivery.Attempts + 1,
+		"response_status": status,
+	}
+
+	if sendErr == nil {
+		changes["status"] = models.WebhookDeliveryStatusSucceeded
+		changes["delivered_at"] = now
+		changes["last_error"] = ""
+
+		return changes
+	}
+
+	changes["last_error"] = sendErr.Error()
+
+	if Delivery.Attempts+1 >= MaxAttempts {
+		changes["status"] = models.WebhookDeliveryStatusFailed
+	} else {
+		changes["next_attempt_at"] = now.Add(Backoff(Delivery.Attempts + 1))
+	}
+
+	return changes
+}
+
+// send posts the signed payload, any answer but 2xx is a failure
+func send(client *http.Client, Subscription models.WebhookSubscriptions, Delivery models.WebhookDeliveries) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, Subscription.URL, bytes.NewReader(Delivery.Payload))
+
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, Delivery.EventType)
+	request.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(Delivery.ID), 10))
+	request.Header.Set(SignatureHeader, Sign(Subscription.Secret, Delivery.Payload))
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("webhook answered %s", response.Status)
+	}
+
+	return response.StatusCode, nil
+}
+
+// StartDispatcher delivers due webhooks every interval in the background until stop is called
+func StartDispatcher(db *gorm.DB, interval time.Duration) (stop func()) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for {
+					count, err := DeliverDue(db, client)
+
+					if err != nil {
+						log.Printf("webhooks: delivering failed: %s", err)
+					}
+
+					if err != nil || count < batchSize {
+						break
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
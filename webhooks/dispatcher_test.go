@@ -0,0 +1,125 @@
+package webhooks
+
+import (
+	"inventoryapp/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendSignsThePayload(t *testing.T) {
+	Subscription := models.WebhookSubscriptions{Secret: "s3cret"}
+	Delivery := models.WebhookDeliveries{GormModel: models.GormModel{ID: 42}, EventType: models.EventProductCreated, Payload: models.RawJSON(`{"id":1}`)}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if got, want := r.Header.Get(SignatureHeader), Sign(Subscription.Secret, body); got != want {
+			t.Errorf("signature %q, want %q", got, want)
+		}
+
+		if got := r.Header.Get(EventHeader); got != models.EventProductCreated {
+			t.Errorf("event %q, want %q", got, models.EventProductCreated)
+		}
+
+		if got := r.Header.Get(DeliveryHeader); got != "42" {
+			t.Errorf("delivery %q, want 42", got)
+		}
+
+		if string(body) != `{"id":1}` {
+			t.Errorf("body %s", body)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	Subscription.URL = server.URL
+
+	status, err := send(server.Client(), Subscription, Delivery)
+
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("send answered %d, %v", status, err)
+	}
+}
+
+func TestFailedDeliveriesAreRetriedWithBackoff(t *testing.T) {
+	calls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	Subscription := models.WebhookSubscriptions{URL: server.URL, Secret: "s3cret"}
+	Delivery := models.WebhookDeliveries{Payload: models.RawJSON(`{}`), Status: models.WebhookDeliveryStatusPending}
+	now := time.Now()
+
+	for calls < 3 {
+		status, sendErr := send(server.Client(), Subscription, Delivery)
+		changes := outcome(Delivery, status, sendErr, now)
+
+		if calls < 3 {
+			if sendErr == nil || status != http.StatusBadGateway {
+				t.Fatalf("attempt %d answered %d, %v", calls, status, sendErr)
+			}
+
+			if got, want := changes["next_attempt_at"], now.Add(Backoff(calls)); got != want {
+				t.Fatalf("attempt %d retries at %v, want %v", calls, got, want)
+			}
+
+			if _, ok := changes["status"]; ok {
+				t.Fatalf("attempt %d changed the status to %v", calls, changes["status"])
+			}
+		} else if changes["status"] != models.WebhookDeliveryStatusSucceeded {
+			t.Fatalf("attempt %d left status %v", calls, changes["status"])
+		}
+
+		Delivery.Attempts = changes["attempts"].(int)
+	}
+}
+
+func TestDeliveriesAreGivenUpAfterMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	Subscription := models.WebhookSubscriptions{URL: server.URL}
+	Delivery := models.WebhookDeliveries{Payload: models.RawJSON(`{}`), Attempts: MaxAttempts - 1}
+
+	status, sendErr := send(server.Client(), Subscription, Delivery)
+	changes := outcome(Delivery, status, sendErr, time.Now())
+
+	if changes["status"] != models.WebhookDeliveryStatusFailed {
+		t.Fatalf("the last attempt left status %v", changes["status"])
+	}
+
+	if _, ok := changes["next_attempt_at"]; ok {
+		t.Fatal("a given up delivery is scheduled again")
+	}
+}
+
+func TestBackoffDoublesUpToAnHour(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		3:  40 * time.Second,
+		9:  2560 * time.Second,
+		10: time.Hour,
+		50: time.Hour,
+	} {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
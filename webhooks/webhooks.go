@@ -0,0 +1,71 @@
+// Package webhooks queues domain events for the webhook subscriptions that asked for them and delivers them.
+// Events reach it from the outbox, see outbox.WebhookSink
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"inventoryapp/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Event is the JSON body every subscription receives, ID is the outbox event so receivers can drop
+// an event they already got
+type Event struct {
+	ID         uint        `json:"id"`
+	Event      string      `json:"event"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Enqueue queues event about the product for every active subscription of its type
+func Enqueue(tx *gorm.DB, productID uint, event Event) error {
+	subscriptions := []models.WebhookSubscriptions{}
+	if err := tx.Debug().Where("disabled = ? AND ? = ANY(event_types)", false, event.Event).Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]models.WebhookDeliveries, 0, len(subscriptions))
+
+	for _, Subscription := range subscriptions {
+		deliveries = append(deliveries, models.WebhookDeliveries{
+			WebhookSubscriptionID: Subscription.ID,
+			ProductID:             productID,
+			EventType:             event.Event,
+			Payload:               payload,
+			Status:                models.WebhookDeliveryStatusPending,
+			NextAttemptAt:         now,
+		})
+	}
+
+	return tx.Debug().Create(&deliveries).Error
+}
+
+// Sign is the signature of body sent in SignatureHeader, receivers compute the same HMAC-SHA256 with their secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}